@@ -0,0 +1,80 @@
+package gocache
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+//
+// serveAdmin
+// @Description: 运维管理接口，<adminPath>peers 支持
+// GET 查看节点，POST ?peer=xxx 加入节点，PUT ?peer=xxx&weight=n 调整节点权重，DELETE ?peer=xxx 摘除节点，
+// 均返回变更后的节点列表。请求需携带Authorization: Bearer <adminToken>
+// @receiver p
+// @param w
+// @param r
+//
+func (p *HTTPPool) serveAdmin(w http.ResponseWriter, r *http.Request) {
+	if !p.authorized(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if strings.TrimPrefix(r.URL.Path, p.adminPath) != "peers" {
+		http.NotFound(w, r)
+		return
+	}
+	peers := r.URL.Query()["peer"]
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		if len(peers) == 0 {
+			http.Error(w, "requires peer", http.StatusBadRequest)
+			return
+		}
+		p.logger.Log(LevelInfo, "admin join peers", Field{"self", p.self}, Field{"peers", peers})
+		p.AddPeers(peers...)
+	case http.MethodPut:
+		weight, err := strconv.Atoi(r.URL.Query().Get("weight"))
+		if len(peers) == 0 || err != nil {
+			http.Error(w, "requires peer and weight", http.StatusBadRequest)
+			return
+		}
+		p.logger.Log(LevelInfo, "admin set peer weight", Field{"self", p.self}, Field{"peers", peers}, Field{"weight", weight})
+		for _, peer := range peers {
+			p.SetWeight(peer, weight)
+		}
+	case http.MethodDelete:
+		if len(peers) == 0 {
+			http.Error(w, "requires peer", http.StatusBadRequest)
+			return
+		}
+		p.logger.Log(LevelInfo, "admin drain peers", Field{"self", p.self}, Field{"peers", peers})
+		p.RemovePeers(peers...)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p.Peers())
+}
+
+//
+// authorized
+// @Description: 校验运维管理接口的令牌，使用常数时间比较避免按耗时猜测令牌
+// @receiver p
+// @param r
+// @return bool
+//
+func (p *HTTPPool) authorized(r *http.Request) bool {
+	//只接受Bearer方式携带的令牌，不带前缀的令牌同样拒绝
+	auth := r.Header.Get("Authorization")
+	if p.adminToken == "" || !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(p.adminToken)) == 1
+}
@@ -0,0 +1,330 @@
+package arc
+
+import (
+	"container/list"
+	"gocache/lru"
+	"time"
+)
+
+type Value = lru.Value
+
+//
+// Cache
+// @Description: 自适应替换缓存(ARC)，在最近访问与频繁访问两个队列间根据幽灵队列的命中情况动态调整容量，
+// 容量按字节计算，幽灵队列只保存key与淘汰前的大小，不计入已使用内存
+//
+type Cache struct {
+	//允许使用的最大内存
+	maxBytes int64
+	//当前已使用内存
+	nbytes int64
+	//t1的目标容量，单位字节
+	p int64
+	//t1保存只访问过一次的记录，t2保存访问过多次的记录
+	t1, t2 *queue
+	//b1、b2分别为t1、t2淘汰记录的幽灵队列
+	b1, b2 *queue
+	cache  map[string]*list.Element
+	//某条记录被移除时的回调函数
+	OnEvicted func(key string, value Value)
+}
+
+//
+// queue
+// @Description: 带字节统计的LRU队列，队首为最近访问
+//
+type queue struct {
+	ll    *list.List
+	bytes int64
+}
+
+func newQueue() *queue {
+	return &queue{ll: list.New()}
+}
+
+type entry struct {
+	key   string
+	value Value
+	//过期时间，零值表示永不过期
+	expire time.Time
+	//记录大小，幽灵记录保留淘汰前的大小
+	size int64
+	//所在队列
+	queue *queue
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+func (e *entry) ghost() bool {
+	return e.value == nil
+}
+
+//
+// New
+// @Description: 实例化Cache
+// @param maxBytes
+// @param OnEvicted
+// @return *Cache
+//
+func New(maxBytes int64, OnEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		t1:        newQueue(),
+		t2:        newQueue(),
+		b1:        newQueue(),
+		b2:        newQueue(),
+		cache:     make(map[string]*list.Element),
+		OnEvicted: OnEvicted,
+	}
+}
+
+//
+// Get
+// @Description: 查找，命中的记录移至t2队首
+// @receiver c
+// @param key
+// @return value
+// @return ok
+//
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	ele, ok := c.cache[key]
+	if !ok || ele.Value.(*entry).ghost() {
+		return nil, false
+	}
+	kv := ele.Value.(*entry)
+	//惰性过期，访问时发现过期直接删除
+	if kv.expired(time.Now()) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	c.move(ele, c.t2)
+	return kv.value, true
+}
+
+//
+// move
+// @Description: 将记录移至目标队列队首
+// @receiver c
+// @param ele
+// @param to
+//
+func (c *Cache) move(ele *list.Element, to *queue) {
+	kv := ele.Value.(*entry)
+	kv.queue.ll.Remove(ele)
+	kv.queue.bytes -= kv.size
+	c.push(kv, to)
+}
+
+func (c *Cache) push(kv *entry, to *queue) {
+	kv.queue = to
+	to.bytes += kv.size
+	c.cache[kv.key] = to.ll.PushFront(kv)
+}
+
+//
+// RemoveOldest
+// @Description: 删除策略，按目标容量p从t1或t2队尾淘汰一条记录，并将其key放入对应的幽灵队列
+// @receiver c
+//
+func (c *Cache) RemoveOldest() {
+	c.replace(false)
+}
+
+func (c *Cache) replace(hitB2 bool) {
+	from, ghost := c.t2, c.b2
+	if c.t1.ll.Len() > 0 && (c.t1.bytes > c.p || (hitB2 && c.t1.bytes == c.p) || c.t2.ll.Len() == 0) {
+		from, ghost = c.t1, c.b1
+	}
+	ele := from.ll.Back()
+	if ele == nil {
+		return
+	}
+	kv := ele.Value.(*entry)
+	value := kv.value
+	c.nbytes -= kv.size
+	kv.value = nil
+	c.move(ele, ghost)
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, value)
+	}
+}
+
+//
+// Add
+// @Description: 添加
+// @receiver c
+// @param key
+// @param value
+//
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+//
+// AddWithExpire
+// @Description: 添加带过期时间的缓存，expire为零值表示永不过期，
+// 更新已有记录或命中幽灵队列的记录进入t2，新记录进入t1
+// @receiver c
+// @param key
+// @param value
+// @param expire
+//
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	size := int64(len(key)) + int64(value.Len())
+	hitB2 := false
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		switch kv.queue {
+		case c.b1:
+			//t1淘汰得太早，增大t1的目标容量
+			c.p = min(c.maxBytes, c.p+size*max(1, c.b2.bytes/max(1, c.b1.bytes)))
+		case c.b2:
+			//t2淘汰得太早，减小t1的目标容量
+			c.p = max(0, c.p-size*max(1, c.b1.bytes/max(1, c.b2.bytes)))
+			hitB2 = true
+		default:
+			c.nbytes -= kv.size
+		}
+		kv.queue.bytes += size - kv.size
+		kv.value, kv.expire, kv.size = value, expire, size
+		c.move(ele, c.t2)
+	} else {
+		c.push(&entry{key: key, value: value, expire: expire, size: size}, c.t1)
+	}
+	c.nbytes += size
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.replace(hitB2)
+	}
+	c.trimGhosts()
+}
+
+//
+// trimGhosts
+// @Description: 限制幽灵队列的长度，保证t1+b1不超过maxBytes，总量不超过2*maxBytes
+// @receiver c
+//
+func (c *Cache) trimGhosts() {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.b1.ll.Len() > 0 && c.t1.bytes+c.b1.bytes > c.maxBytes {
+		c.dropGhost(c.b1)
+	}
+	for c.b2.ll.Len() > 0 && c.t1.bytes+c.t2.bytes+c.b1.bytes+c.b2.bytes > 2*c.maxBytes {
+		c.dropGhost(c.b2)
+	}
+}
+
+func (c *Cache) dropGhost(q *queue) {
+	ele := q.ll.Back()
+	kv := ele.Value.(*entry)
+	q.ll.Remove(ele)
+	q.bytes -= kv.size
+	delete(c.cache, kv.key)
+}
+
+//
+// Remove
+// @Description: 删除指定key的缓存，返回是否存在
+// @receiver c
+// @param key
+// @return bool
+//
+func (c *Cache) Remove(key string) bool {
+	ele, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	if ele.Value.(*entry).ghost() {
+		c.dropElement(ele)
+		return false
+	}
+	c.removeElement(ele)
+	return true
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	c.dropElement(ele)
+	c.nbytes -= kv.size
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+func (c *Cache) dropElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	kv.queue.ll.Remove(ele)
+	kv.queue.bytes -= kv.size
+	delete(c.cache, kv.key)
+}
+
+//
+// RemoveExpired
+// @Description: 清理所有已过期的缓存，返回清理的条数
+// @receiver c
+// @return int
+//
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	removed := 0
+	for _, q := range []*queue{c.t1, c.t2} {
+		for ele := q.ll.Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*entry).expired(now) {
+				c.removeElement(ele)
+				removed++
+			}
+			ele = prev
+		}
+	}
+	return removed
+}
+
+//
+// Range
+// @Description: 依次从最久未访问到最近访问遍历t1与t2，不包括幽灵记录，跳过已过期的记录，不改变访问顺序，fn返回false时停止
+// @receiver c
+// @param fn
+//
+func (c *Cache) Range(fn func(key string, value Value, expire time.Time) bool) {
+	now := time.Now()
+	for _, q := range []*queue{c.t1, c.t2} {
+		for ele := q.ll.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			if !kv.expired(now) && !fn(kv.key, kv.value, kv.expire) {
+				return
+			}
+		}
+	}
+}
+
+//
+// Bytes
+// @Description: 当前已使用内存
+// @receiver c
+// @return int64
+//
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+func (c *Cache) Len() int {
+	return c.t1.ll.Len() + c.t2.ll.Len()
+}
+
+func min(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,110 @@
+package arc
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestScan(t *testing.T) {
+	arc := New(40, nil)
+	for i := 0; i < 5; i++ {
+		arc.Add("hot"+strconv.Itoa(i), String("v"))
+		arc.Get("hot" + strconv.Itoa(i))
+	}
+	//一次性扫描的记录只在t1中轮换，不会淘汰t2中的记录
+	for i := 0; i < 100; i++ {
+		arc.Add("scan"+strconv.Itoa(i), String("v"))
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := arc.Get("hot" + strconv.Itoa(i)); !ok {
+			t.Fatalf("hot key %d evicted by scan", i)
+		}
+	}
+	if arc.Bytes() > 40 {
+		t.Fatalf("bytes %d exceeds limit", arc.Bytes())
+	}
+}
+
+func TestGhost(t *testing.T) {
+	var evicted []string
+	//每条记录占用4字节
+	arc := New(12, func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	arc.Add("k1", String("v1"))
+	arc.Add("k2", String("v2"))
+	arc.Get("k1")
+	arc.Get("k2")
+	arc.Add("k3", String("v3"))
+	arc.Add("k4", String("v4"))
+	if len(evicted) != 1 || evicted[0] != "k3" {
+		t.Fatalf("expected k3 evicted, got %v", evicted)
+	}
+	if _, ok := arc.Get("k3"); ok {
+		t.Fatalf("ghost entry should not be returned")
+	}
+	//命中幽灵队列，增大t1的目标容量并直接进入t2，t2随之淘汰k1
+	arc.Add("k3", String("v3"))
+	if arc.p != 4 || evicted[1] != "k1" || arc.t2.ll.Len() != 2 || arc.Len() != 3 || arc.Bytes() != 12 {
+		t.Fatalf("unexpected state p=%d t2=%d len=%d bytes=%d", arc.p, arc.t2.ll.Len(), arc.Len(), arc.Bytes())
+	}
+}
+
+func TestRemove(t *testing.T) {
+	evicted := make([]string, 0)
+	arc := New(0, func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	arc.Add("key1", String("1234"))
+	arc.Add("key2", String("5678"))
+	arc.Add("key2", String("56"))
+	if !arc.Remove("key1") || arc.Remove("key1") {
+		t.Fatalf("remove should report existence")
+	}
+	if arc.Len() != 1 || arc.Bytes() != int64(len("key2")+len("56")) {
+		t.Fatalf("unexpected len %d bytes %d", arc.Len(), arc.Bytes())
+	}
+	if len(evicted) != 1 || evicted[0] != "key1" {
+		t.Fatalf("OnEvicted not called, got %v", evicted)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	arc := New(0, nil)
+	arc.AddWithExpire("key1", String("1234"), time.Now().Add(-time.Second))
+	arc.AddWithExpire("key2", String("5678"), time.Now().Add(time.Hour))
+	arc.Add("key3", String("9"))
+	if _, ok := arc.Get("key1"); ok || arc.Len() != 2 {
+		t.Fatalf("expired key1 should be removed lazily")
+	}
+	arc.AddWithExpire("key2", String("5678"), time.Now().Add(-time.Second))
+	if n := arc.RemoveExpired(); n != 1 || arc.Len() != 1 {
+		t.Fatalf("expected 1 expired entry removed, got %d", n)
+	}
+	if _, ok := arc.Get("key3"); !ok {
+		t.Fatalf("key3 should never expire")
+	}
+}
+
+func TestGhostZeroSize(t *testing.T) {
+	//每条非空记录占用2字节，空key与空值占用0字节
+	arc := New(2, nil)
+	arc.Add("d", String("v"))
+	arc.Add("d", String("v"))
+	arc.Add("c", String("v"))
+	arc.Add("c", String("v"))
+	arc.Add("", String(""))
+	arc.Add("d", String("v"))
+	//空记录被淘汰至b1后b1占用0字节，再次命中时不能除以0
+	arc.Add("", String(""))
+	if arc.Bytes() > 2 {
+		t.Fatalf("bytes %d exceeds limit", arc.Bytes())
+	}
+}
@@ -0,0 +1,352 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	pb "gocache/gocachepb"
+	"sync"
+	"time"
+)
+
+//
+// BatchGetter
+// @Description: 可选实现，批量回调获取数据，返回结果中缺失的key视为不存在
+//
+type BatchGetter interface {
+	GetMany(ctx context.Context, keys []string) (map[string][]byte, error)
+}
+
+type BatchGetterFunc func(ctx context.Context, keys []string) (map[string][]byte, error)
+
+func (f BatchGetterFunc) Get(ctx context.Context, key string) ([]byte, error) {
+	values, err := f(ctx, []string{key})
+	if err != nil {
+		return nil, err
+	}
+	if v, ok := values[key]; ok {
+		return v, nil
+	}
+	return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+}
+
+func (f BatchGetterFunc) GetMany(ctx context.Context, keys []string) (map[string][]byte, error) {
+	return f(ctx, keys)
+}
+
+//
+// GetMany
+// @Description: 批量获取缓存
+// @receiver g
+// @param keys
+// @return []ByteView
+// @return []error
+//
+func (g *Group) GetMany(keys []string) ([]ByteView, []error) {
+	return g.GetManyContext(context.Background(), keys)
+}
+
+//
+// GetManyContext
+// @Description: 批量获取缓存，未命中的key与Get一样经过副本、二级缓存与并发合并，按副本节点分组，每个节点只发起一次批量请求，
+// 本节点负责的key通过批量回调加载，返回值与keys一一对应
+// @receiver g
+// @param ctx
+// @param keys
+// @return []ByteView
+// @return []error
+//
+func (g *Group) GetManyContext(ctx context.Context, keys []string) ([]ByteView, []error) {
+	values := make([]ByteView, len(keys))
+	errs := make([]error, len(keys))
+	//key到其在结果中下标的映射，同一个key可能出现多次
+	misses := make(map[string][]int)
+	var order []string
+	g.stats.gets.Add(int64(len(keys)))
+	for i, key := range keys {
+		if key == "" {
+			errs[i] = fmt.Errorf("requires key")
+			continue
+		}
+		if v, ok := g.lookupCache(key); ok {
+			values[i] = v
+			continue
+		}
+		if g.lookupNegative(key) {
+			errs[i] = ErrNotFound
+			continue
+		}
+		if _, ok := misses[key]; !ok {
+			order = append(order, key)
+		}
+		misses[key] = append(misses[key], i)
+	}
+	if len(order) == 0 {
+		return values, errs
+	}
+	if err := ctx.Err(); err != nil {
+		for _, key := range order {
+			for _, i := range misses[key] {
+				errs[i] = err
+			}
+		}
+		return values, errs
+	}
+
+	g.stats.loads.Add(int64(len(order)))
+	forwarded := isForwarded(ctx)
+	ctx, cancel := g.loadContext(ctx)
+	defer cancel()
+	//与Get共享加载，已在加载中的key等待已有的加载，其余key合并为一次批量加载
+	loaded, loadErrs := g.loader.DoManyContext(ctx, order, func(ctx context.Context, keys []string) ([]interface{}, []error) {
+		g.stats.loadsDeduped.Add(int64(len(keys)))
+		return g.loadMany(ctx, keys, forwarded)
+	})
+	for j, key := range order {
+		for _, i := range misses[key] {
+			if errs[i] = loadErrs[j]; errs[i] == nil {
+				values[i] = loaded[j].(ByteView)
+			}
+		}
+	}
+	return values, errs
+}
+
+//
+// loadMany
+// @Description: 与load相同的方式加载多个key，按优先级依次向副本节点查询，每轮对每个节点只发起一次批量请求，
+// 查询失败的key转向下一个副本，轮到本节点时本地加载
+// @receiver g
+// @param ctx
+// @param keys
+// @param forwarded 请求是否由其余节点转发而来，转发而来的请求直接本地加载
+// @return []interface{} 与keys一一对应
+// @return []error 与keys一一对应
+//
+func (g *Group) loadMany(ctx context.Context, keys []string, forwarded bool) ([]interface{}, []error) {
+	values := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	replicas := make([][]PeerGetter, len(keys))
+	//各key下一个要查询的副本下标
+	next := make([]int, len(keys))
+	var pending, local []int
+	for i, key := range keys {
+		replicas[i] = []PeerGetter{nil}
+		if !forwarded {
+			replicas[i] = g.pickReplicas(key)
+		}
+		//本节点不再是副本时二级缓存中的记录可能已过时，丢弃后向新的副本节点查询
+		if !hasLocal(replicas[i]) {
+			g.dropL2(key)
+		} else if value, ok := g.lookupL2(key); ok {
+			values[i] = value
+			continue
+		}
+		pending = append(pending, i)
+	}
+	for len(pending) > 0 {
+		batches := make(map[PeerGetter][]int)
+		for _, i := range pending {
+			if next[i] < len(replicas[i]) && replicas[i][next[i]] != nil {
+				batches[replicas[i][next[i]]] = append(batches[replicas[i][next[i]]], i)
+				continue
+			}
+			local = append(local, i)
+		}
+		pending = nil
+		var (
+			wg sync.WaitGroup
+			mu sync.Mutex
+		)
+		for peer, batch := range batches {
+			wg.Add(1)
+			go func(peer PeerGetter, batch []int) {
+				defer wg.Done()
+				retry := g.loadManyFromPeer(ctx, peer, keys, batch, replicas, next, values, errs)
+				mu.Lock()
+				pending = append(pending, retry...)
+				mu.Unlock()
+			}(peer, batch)
+		}
+		wg.Wait()
+	}
+	g.getManyLocally(ctx, keys, local, replicas, values, errs)
+	return values, errs
+}
+
+//
+// loadManyFromPeer
+// @Description: 向一个副本节点批量查询batch中的key，结果写入values与errs，
+// 请求失败或单个key返回NotFound以外的错误时将其转向下一个副本
+// @receiver g
+// @param ctx
+// @param peer
+// @param keys
+// @param batch 本次查询的key在keys中的下标
+// @param replicas 各key的副本节点
+// @param next 各key下一个要查询的副本下标
+// @param values
+// @param errs
+// @return []int 需要继续查询的key的下标
+//
+func (g *Group) loadManyFromPeer(ctx context.Context, peer PeerGetter, keys []string, batch []int, replicas [][]PeerGetter,
+	next []int, values []interface{}, errs []error) []int {
+	batchKeys := make([]string, len(batch))
+	for j, i := range batch {
+		batchKeys[j] = keys[i]
+	}
+	start := time.Now()
+	peerValues, peerErrs, err := g.getManyFromPeer(ctx, peer, batchKeys)
+	if err != nil {
+		g.logger.Log(LevelWarn, "failed to load batch from peer", Field{"group", g.name},
+			Field{"peer", peer}, Field{"keys", len(batch)}, Field{"latency", time.Since(start)}, Field{"err", err})
+	}
+	var retry []int
+	for j, i := range batch {
+		keyErr := err
+		if keyErr == nil {
+			keyErr = peerErrs[j]
+		}
+		next[i]++
+		if keyErr == nil {
+			//本节点同为副本时保存到主缓存
+			if hasLocal(replicas[i][next[i]:]) {
+				g.populateCache(keys[i], peerValues[j])
+			}
+			values[i] = peerValues[j]
+			continue
+		}
+		//副本节点确认key不存在或加载已超时时不再继续
+		if errors.Is(keyErr, ErrNotFound) || ctx.Err() != nil {
+			errs[i] = keyErr
+			continue
+		}
+		if err == nil {
+			g.logKey(LevelWarn, "failed to load from peer", keys[i], Field{"peer", peer}, Field{"err", keyErr})
+		}
+		retry = append(retry, i)
+	}
+	return retry
+}
+
+//
+// getManyFromPeer
+// @Description: 向远程节点发起一次批量请求，请求本身失败时返回错误，单个key的结果与错误与keys一一对应
+// @receiver g
+// @param ctx
+// @param peer
+// @param keys
+// @return []ByteView
+// @return []error
+// @return error
+//
+func (g *Group) getManyFromPeer(ctx context.Context, peer PeerGetter, keys []string) ([]ByteView, []error, error) {
+	req := &pb.BatchRequest{
+		Group:     g.name,
+		Keys:      keys,
+		Forwarded: true,
+	}
+	res := &pb.BatchResponse{}
+	if err := peer.GetMany(ctx, req, res); err != nil {
+		g.stats.peerErrors.Add(1)
+		return nil, nil, err
+	}
+	if len(res.Responses) != len(keys) {
+		g.stats.peerErrors.Add(1)
+		return nil, nil, fmt.Errorf("peer returned %d responses for %d keys", len(res.Responses), len(keys))
+	}
+	g.stats.peerLoads.Add(1)
+	values := make([]ByteView, len(keys))
+	errs := make([]error, len(keys))
+	for i, key := range keys {
+		r := res.Responses[i]
+		if err := responseError(r); err != nil {
+			if errors.Is(err, ErrNotFound) {
+				g.populateNegative(key)
+			}
+			errs[i] = err
+			continue
+		}
+		values[i] = ByteView{b: r.Value, e: fromUnixNano(r.Expire), l: time.Now()}
+		g.populateHotCache(key, values[i])
+	}
+	return values, errs, nil
+}
+
+//
+// getManyLocally
+// @Description: 本地加载多个key，回调实现了BatchGetter时只调用一次，否则逐个加载，加载成功后写入其余副本节点
+// @receiver g
+// @param ctx
+// @param keys
+// @param local 需要本地加载的key在keys中的下标
+// @param replicas 各key的副本节点
+// @param values
+// @param errs
+//
+func (g *Group) getManyLocally(ctx context.Context, keys []string, local []int, replicas [][]PeerGetter, values []interface{}, errs []error) {
+	if len(local) == 0 {
+		return
+	}
+	getter, ok := g.getter.(BatchGetter)
+	if !ok {
+		for _, i := range local {
+			value, err := g.getLocally(ctx, keys[i])
+			if err != nil {
+				errs[i] = err
+				continue
+			}
+			g.replicate(keys[i], value, replicas[i])
+			values[i] = value
+		}
+		return
+	}
+	localKeys := make([]string, len(local))
+	for j, i := range local {
+		localKeys[j] = keys[i]
+	}
+	start := time.Now()
+	found, err := getter.GetMany(ctx, localKeys)
+	g.loadLatency.observe(time.Since(start))
+	for _, i := range local {
+		key := keys[i]
+		if err != nil {
+			g.stats.localLoadErrs.Add(1)
+			errs[i] = err
+			continue
+		}
+		bytes, ok := found[key]
+		if !ok {
+			g.stats.localLoadErrs.Add(1)
+			g.populateNegative(key)
+			errs[i] = fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+			continue
+		}
+		g.stats.localLoads.Add(1)
+		value := ByteView{b: cloneBytes(bytes), e: g.expireAt(0), l: time.Now()}
+		g.populateCache(key, value)
+		g.replicate(key, value, replicas[i])
+		values[i] = value
+	}
+}
+
+//
+// batchResponse
+// @Description: 服务端处理批量请求，将结果封装为BatchResponse
+// @param ctx
+// @param group
+// @param keys
+// @return *pb.BatchResponse
+//
+func batchResponse(ctx context.Context, group *Group, keys []string) *pb.BatchResponse {
+	values, errs := group.GetManyContext(ctx, keys)
+	res := &pb.BatchResponse{Responses: make([]*pb.Response, len(keys))}
+	for i := range keys {
+		if errs[i] != nil {
+			res.Responses[i] = errorResponse(errs[i])
+			continue
+		}
+		res.Responses[i] = &pb.Response{Value: values[i].ByteSlice(), Expire: toUnixNano(values[i].e)}
+	}
+	return res
+}
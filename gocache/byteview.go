@@ -1,11 +1,17 @@
 package gocache
 
+import "time"
+
 //
 // ByteView
 // @Description: 表示缓存值
 //
 type ByteView struct {
 	b []byte
+	//过期时间，零值表示永不过期
+	e time.Time
+	//加载时间，用于计算预刷新的时机
+	l time.Time
 }
 
 //
@@ -18,6 +24,16 @@ func (v ByteView) Len() int {
 	return len(v.b)
 }
 
+//
+// Expire
+// @Description: 返回缓存的过期时间，零值表示永不过期
+// @receiver v
+// @return time.Time
+//
+func (v ByteView) Expire() time.Time {
+	return v.e
+}
+
 //
 // ByteSlice
 // @Description: 返回一份缓存的切片拷贝
@@ -43,3 +59,29 @@ func cloneBytes(b []byte) []byte {
 	copy(c, b)
 	return c
 }
+
+//
+// toUnixNano
+// @Description: 过期时间转为unix纳秒时间戳，零值对应0
+// @param t
+// @return int64
+//
+func toUnixNano(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+//
+// fromUnixNano
+// @Description: unix纳秒时间戳转为过期时间，0对应零值
+// @param n
+// @return time.Time
+//
+func fromUnixNano(n int64) time.Time {
+	if n == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, n)
+}
@@ -1,49 +1,377 @@
 package gocache
 
 import (
+	"gocache/internal/fnv1a"
 	"gocache/lru"
+	"runtime"
 	"sync"
+	"time"
 )
 
+const (
+	defaultSweepInterval = time.Minute
+	//从远程节点获取的值有1/hotCacheSampling的概率放入热点缓存
+	hotCacheSampling = 10
+	//默认分片时每个分片至少分得的内存，容量较小的缓存不分片
+	minShardBytes = 64 << 10
+	//默认分片数为GOMAXPROCS的shardsPerProc倍
+	shardsPerProc = 4
+)
+
+//
+// CacheStats
+// @Description: 缓存的统计信息
+//
+type CacheStats struct {
+	Bytes int64
+	Items int64
+	Gets  int64
+	Hits  int64
+	//被淘汰、过期清理或删除的条数
+	Evictions int64
+}
+
+//
+// cache
+// @Description: 并发安全的本地缓存，按key的哈希分为多个独立加锁的分片，每个分片分得cacheBytes的一部分
+//
 type cache struct {
-	mu         sync.Mutex
-	lru        *lru.Cache
 	cacheBytes int64
+	//淘汰策略的构造函数，nil表示LRU
+	newPolicy PolicyFunc
+	//后台清理过期缓存的间隔
+	sweepInterval time.Duration
+	//过期后继续保留的时长，期间可返回旧值并后台刷新
+	stale time.Duration
+	//分片数，0表示按GOMAXPROCS与cacheBytes自动计算
+	shardCount int
+	//单条记录（key与value）的最大字节数，分片数受其限制使每个分片都能容纳，0表示不限制
+	maxEntryBytes int64
+	//延迟初始化分片
+	initOnce sync.Once
+	shards   []*cacheShard
+	//出现带过期时间的缓存时才启动后台清理
+	sweepOnce sync.Once
+	//关闭后停止后台清理
+	closeOnce sync.Once
+	done      chan struct{}
+	//写入时因容量被淘汰的记录，在释放分片锁后逐条回调，过期清理与主动删除的记录不回调
+	onEvicted func(key string, value ByteView)
+}
+
+//
+// cacheEntry
+// @Description: 在分片锁外处理的一条记录
+//
+type cacheEntry struct {
+	key   string
+	value ByteView
+}
+
+//
+// cacheShard
+// @Description: 缓存分片，淘汰策略会修改内部链表，读操作同样需要加互斥锁
+//
+type cacheShard struct {
+	mu     sync.Mutex
+	policy EvictionPolicy
+	nget   int64
+	nhit   int64
+	nevict int64
+	//写入期间收集被淘汰的记录
+	collecting bool
+	evicted    []cacheEntry
+}
+
+//
+// shardsFor
+// @Description: 计算默认分片数，取2的幂
+// @param cacheBytes
+// @return int
+//
+func shardsFor(cacheBytes int64) int {
+	n := 1
+	for n < runtime.GOMAXPROCS(0)*shardsPerProc {
+		n <<= 1
+	}
+	for cacheBytes > 0 && n > 1 && cacheBytes/int64(n) < minShardBytes {
+		n >>= 1
+	}
+	return n
+}
+
+//
+// init
+// @Description: 延迟初始化分片，淘汰策略在分片首次写入时创建
+// @receiver c
+//
+func (c *cache) init() {
+	c.initOnce.Do(func() {
+		n := c.shardCount
+		if n <= 0 {
+			n = shardsFor(c.cacheBytes)
+		}
+		//每个分片至少分得1字节，否则分片容量为0表示不限制
+		if c.cacheBytes > 0 && int64(n) > c.cacheBytes {
+			n = int(c.cacheBytes)
+		}
+		//超过分片容量的记录写入后会立即被淘汰，减少分片数使每个分片都能容纳最大的记录
+		if c.cacheBytes > 0 && c.maxEntryBytes > 0 {
+			if max := c.cacheBytes / c.maxEntryBytes; int64(n) > max {
+				n = int(max)
+			}
+			if n < 1 {
+				n = 1
+			}
+		}
+		c.shards = make([]*cacheShard, n)
+		for i := range c.shards {
+			c.shards[i] = &cacheShard{}
+		}
+		c.done = make(chan struct{})
+	})
+}
+
+//
+// shard
+// @Description: 按key的FNV-1a哈希选取分片
+// @receiver c
+// @param key
+// @return *cacheShard
+//
+func (c *cache) shard(key string) *cacheShard {
+	c.init()
+	return c.shards[fnv1a.Sum32(key)%uint32(len(c.shards))]
 }
 
 //
 // add
-// @Description: 封装lru的add方法，添加并发支持
+// @Description: 封装淘汰策略的add方法，添加并发支持
 // @receiver c
 // @param key
 // @param value
 //
 func (c *cache) add(key string, value ByteView) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
+	s := c.shard(key)
+	s.mu.Lock()
+	evicted := c.addLocked(s, key, value)
+	s.mu.Unlock()
+	c.notifyEvicted(evicted)
+}
+
+//
+// addIfAbsent
+// @Description: 只在缓存中没有该key时添加，返回是否添加
+// @receiver c
+// @param key
+// @param value
+// @return bool
+//
+func (c *cache) addIfAbsent(key string, value ByteView) bool {
+	s := c.shard(key)
+	s.mu.Lock()
+	if s.policy != nil {
+		if _, ok := s.policy.Get(key); ok {
+			s.mu.Unlock()
+			return false
+		}
+	}
+	evicted := c.addLocked(s, key, value)
+	s.mu.Unlock()
+	c.notifyEvicted(evicted)
+	return true
+}
+
+//
+// addLocked
+// @Description: 写入分片，调用方需持有分片的锁，释放锁后将返回的记录交给notifyEvicted
+// @receiver c
+// @param s
+// @param key
+// @param value
+// @return []cacheEntry 因容量被淘汰的记录
+//
+func (c *cache) addLocked(s *cacheShard, key string, value ByteView) []cacheEntry {
 	//延迟初始化，懒汉式创建
-	if c.lru == nil {
-		c.lru = lru.New(c.cacheBytes, nil)
+	if s.policy == nil {
+		newPolicy := c.newPolicy
+		if newPolicy == nil {
+			newPolicy = LRU
+		}
+		s.policy = newPolicy(c.cacheBytes/int64(len(c.shards)), func(key string, value lru.Value) {
+			s.nevict++
+			if s.collecting {
+				s.evicted = append(s.evicted, cacheEntry{key, value.(ByteView)})
+			}
+		})
+	}
+	expire := value.e
+	if !expire.IsZero() {
+		expire = expire.Add(c.stale)
+	}
+	s.collecting = c.onEvicted != nil
+	s.policy.AddWithExpire(key, value, expire)
+	s.collecting = false
+	if !value.e.IsZero() {
+		c.sweepOnce.Do(func() {
+			go c.sweep()
+		})
+	}
+	evicted := s.evicted
+	s.evicted = nil
+	return evicted
+}
+
+//
+// notifyEvicted
+// @Description: 在分片锁外回调被淘汰的记录，回调可以执行磁盘写入等耗时操作
+// @receiver c
+// @param evicted
+//
+func (c *cache) notifyEvicted(evicted []cacheEntry) {
+	for _, e := range evicted {
+		c.onEvicted(e.key, e.value)
 	}
-	c.lru.Add(key, value)
 }
 
 //
 // get
-// @Description: 封装lru的get方法，添加并发支持
+// @Description: 封装淘汰策略的get方法，添加并发支持
 // @receiver c
 // @param key
 // @return value
 // @return ok
 //
 func (c *cache) get(key string) (value ByteView, ok bool) {
-	c.mu.Lock()
-	defer c.mu.Unlock()
-	if c.lru == nil {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nget++
+	if s.policy == nil {
 		return
 	}
-	if v, ok := c.lru.Get(key); ok {
+	if v, ok := s.policy.Get(key); ok {
+		s.nhit++
 		return v.(ByteView), ok
 	}
 	return
 }
+
+//
+// remove
+// @Description: 封装淘汰策略的remove方法，添加并发支持
+// @receiver c
+// @param key
+//
+func (c *cache) remove(key string) {
+	s := c.shard(key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.policy == nil {
+		return
+	}
+	s.policy.Remove(key)
+}
+
+//
+// rangeEntries
+// @Description: 逐个分片按淘汰顺序遍历缓存，先在锁内复制分片的记录再调用fn，fn可以执行耗时操作，fn返回false时停止
+// @receiver c
+// @param fn
+//
+func (c *cache) rangeEntries(fn func(key string, value ByteView) bool) {
+	c.init()
+	for _, s := range c.shards {
+		var entries []cacheEntry
+		s.mu.Lock()
+		if s.policy != nil {
+			entries = make([]cacheEntry, 0, s.policy.Len())
+			s.policy.Range(func(key string, value lru.Value, _ time.Time) bool {
+				entries = append(entries, cacheEntry{key, value.(ByteView)})
+				return true
+			})
+		}
+		s.mu.Unlock()
+		for _, e := range entries {
+			if !fn(e.key, e.value) {
+				return
+			}
+		}
+	}
+}
+
+//
+// removeExpired
+// @Description: 逐个分片清理已过期的缓存
+// @receiver c
+// @return int
+//
+func (c *cache) removeExpired() int {
+	c.init()
+	removed := 0
+	for _, s := range c.shards {
+		s.mu.Lock()
+		if s.policy != nil {
+			removed += s.policy.RemoveExpired()
+		}
+		s.mu.Unlock()
+	}
+	return removed
+}
+
+//
+// sweep
+// @Description: 后台定期清理过期缓存，无需等待淘汰策略淘汰即可回收内存
+// @receiver c
+//
+func (c *cache) sweep() {
+	interval := c.sweepInterval
+	if interval <= 0 {
+		interval = defaultSweepInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			c.removeExpired()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+//
+// close
+// @Description: 停止后台清理，可重复调用
+// @receiver c
+//
+func (c *cache) close() {
+	c.init()
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+//
+// stats
+// @Description: 汇总各分片的统计信息
+// @receiver c
+// @return CacheStats
+//
+func (c *cache) stats() CacheStats {
+	c.init()
+	var stats CacheStats
+	for _, s := range c.shards {
+		s.mu.Lock()
+		stats.Gets += s.nget
+		stats.Hits += s.nhit
+		stats.Evictions += s.nevict
+		if s.policy != nil {
+			stats.Bytes += s.policy.Bytes()
+			stats.Items += int64(s.policy.Len())
+		}
+		s.mu.Unlock()
+	}
+	return stats
+}
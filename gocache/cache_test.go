@@ -0,0 +1,144 @@
+package gocache
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestCacheShards(t *testing.T) {
+	c := &cache{cacheBytes: 8 << 10, shardCount: 8}
+	for i := 0; i < 1000; i++ {
+		key := "key" + strconv.Itoa(i)
+		c.add(key, ByteView{b: []byte("0123456789")})
+	}
+	if len(c.shards) != 8 {
+		t.Fatalf("expected 8 shards, got %d", len(c.shards))
+	}
+	for i, s := range c.shards {
+		if s.policy == nil || s.policy.Len() == 0 {
+			t.Fatalf("shard %d is empty, keys are not spread", i)
+		}
+		if s.policy.Bytes() > 1<<10 {
+			t.Fatalf("shard %d holds %d bytes over its share", i, s.policy.Bytes())
+		}
+	}
+	stats := c.stats()
+	if stats.Bytes > 8<<10 || stats.Items == 0 || stats.Evictions == 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	if _, ok := c.get("key999"); !ok {
+		t.Fatalf("most recent key should be cached")
+	}
+	c.remove("key999")
+	if _, ok := c.get("key999"); ok {
+		t.Fatalf("key999 should be removed")
+	}
+	if s := c.stats(); s.Gets != 2 || s.Hits != 1 {
+		t.Fatalf("unexpected get stats %+v", s)
+	}
+}
+
+func TestShardsFor(t *testing.T) {
+	if n := shardsFor(2 << 10); n != 1 {
+		t.Fatalf("small cache should not be sharded, got %d", n)
+	}
+	n := shardsFor(0)
+	if n < 1 || n&(n-1) != 0 {
+		t.Fatalf("shard count %d should be a power of two", n)
+	}
+	if m := shardsFor(minShardBytes * 2); m > 2 {
+		t.Fatalf("each shard should hold at least minShardBytes, got %d shards", m)
+	}
+}
+
+func TestCacheClose(t *testing.T) {
+	c := &cache{cacheBytes: 1 << 10, sweepInterval: time.Millisecond}
+	c.add("k", ByteView{b: []byte("v"), e: time.Now().Add(time.Minute)})
+	c.close()
+	c.close()
+	//关闭后清理协程立即退出
+	exited := make(chan struct{})
+	go func() {
+		c.sweep()
+		close(exited)
+	}()
+	select {
+	case <-exited:
+	case <-time.After(time.Second):
+		t.Fatalf("expected sweep to stop after close")
+	}
+}
+
+func TestCacheShardsCapped(t *testing.T) {
+	//分片数超过容量时每个分片的容量会变为0，即不限制
+	c := &cache{cacheBytes: 4, shardCount: 8}
+	for i := 0; i < 100; i++ {
+		c.add("k"+strconv.Itoa(i), ByteView{b: []byte("v")})
+	}
+	if len(c.shards) != 4 {
+		t.Fatalf("expected shards to be capped at 4, got %d", len(c.shards))
+	}
+	if stats := c.stats(); stats.Bytes > 4 {
+		t.Fatalf("cache grew over its budget: %+v", stats)
+	}
+}
+
+func TestCacheOversizedEntry(t *testing.T) {
+	loads := 0
+	//16个分片时每个分片只有64KB，100KB的记录写入后会立即被淘汰
+	g := NewGroup("oversized", 1<<20, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return make([]byte, 100<<10), nil
+		}), WithShards(16), WithMaxEntryBytes(128<<10))
+	defer g.Close()
+	for i := 0; i < 2; i++ {
+		if v, err := g.Get("big"); err != nil || v.Len() != 100<<10 {
+			t.Fatalf("unexpected value of %d bytes: %v", v.Len(), err)
+		}
+	}
+	if loads != 1 {
+		t.Fatalf("expected the oversized entry to be cached, loaded %d times", loads)
+	}
+	if n := len(g.mainCache.shards); n != 8 {
+		t.Fatalf("expected shards to be capped at 8, got %d", n)
+	}
+}
+
+//
+// benchmarkCacheParallel
+// @Description: 多协程并发读写，配合-cpu参数观察吞吐随GOMAXPROCS的变化
+// @param b
+// @param shards
+//
+func benchmarkCacheParallel(b *testing.B, shards int) {
+	c := &cache{cacheBytes: 64 << 20, shardCount: shards}
+	keys := make([]string, 1<<14)
+	for i := range keys {
+		keys[i] = "key" + strconv.Itoa(i)
+		c.add(keys[i], ByteView{b: []byte("0123456789")})
+	}
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			key := keys[i&(len(keys)-1)]
+			//九成读一成写
+			if i%10 == 0 {
+				c.add(key, ByteView{b: []byte("0123456789")})
+			} else {
+				c.get(key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkCacheSingleShard(b *testing.B) {
+	benchmarkCacheParallel(b, 1)
+}
+
+func BenchmarkCacheSharded(b *testing.B) {
+	benchmarkCacheParallel(b, 0)
+}
@@ -2,6 +2,7 @@ package consistenthash
 
 import (
 	"hash/crc32"
+	"math"
 	"sort"
 	"strconv"
 )
@@ -19,6 +20,8 @@ type Map struct {
 	keys []int
 	//虚拟节点和真实节点的映射表，键为虚拟节点hash值，值为真实节点名称
 	hashMap map[int]string
+	//真实节点的权重，虚拟节点数为replicas*权重
+	weights map[string]int
 }
 
 //
@@ -33,6 +36,7 @@ func New(replicas int, fn Hash) *Map {
 		replicas: replicas,
 		hash:     fn,
 		hashMap:  make(map[int]string),
+		weights:  make(map[string]int),
 	}
 	if m.hash == nil {
 		m.hash = defaultHashFunc
@@ -42,22 +46,75 @@ func New(replicas int, fn Hash) *Map {
 
 //
 // Add
-// @Description: 根据节点名称添加节点
+// @Description: 根据节点名称添加权重为1的节点，已存在的节点会被忽略
 // @receiver m
 // @param keys
 //
 func (m *Map) Add(keys ...string) {
 	for _, key := range keys {
-		for i := 0; i < m.replicas; i++ {
-			hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
-			m.keys = append(m.keys, hash)
-			m.hashMap[hash] = key
+		if _, ok := m.weights[key]; !ok {
+			m.addVirtual(key, 0, m.replicas)
+			m.weights[key] = 1
 		}
 	}
 	//对哈希环进行排序
 	sort.Ints(m.keys)
 }
 
+//
+// SetWeight
+// @Description: 调整节点权重，节点不存在时加入，权重不大于0时移除。
+// 虚拟节点编号连续，调整时只增删差额部分，其余key的归属保持不变
+// @receiver m
+// @param key
+// @param weight
+//
+func (m *Map) SetWeight(key string, weight int) {
+	if weight < 0 {
+		weight = 0
+	}
+	old := m.weights[key]
+	switch {
+	case weight > old:
+		m.addVirtual(key, old*m.replicas, weight*m.replicas)
+		sort.Ints(m.keys)
+	case weight < old:
+		m.removeVirtual(key, weight*m.replicas, old*m.replicas)
+	}
+	if weight > 0 {
+		m.weights[key] = weight
+	} else {
+		delete(m.weights, key)
+	}
+}
+
+//
+// Weight
+// @Description: 返回节点权重，节点不存在时为0
+// @receiver m
+// @param key
+// @return int
+//
+func (m *Map) Weight(key string) int {
+	return m.weights[key]
+}
+
+//
+// addVirtual
+// @Description: 添加编号在[from, to)内的虚拟节点，调用方负责排序
+// @receiver m
+// @param key
+// @param from
+// @param to
+//
+func (m *Map) addVirtual(key string, from, to int) {
+	for i := from; i < to; i++ {
+		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		m.keys = append(m.keys, hash)
+		m.hashMap[hash] = key
+	}
+}
+
 //
 // Get
 // @Description: 一致性哈希 得到key值对应节点
@@ -66,7 +123,7 @@ func (m *Map) Add(keys ...string) {
 // @return string
 //
 func (m *Map) Get(key string) string {
-	if len(key) == 0 {
+	if len(key) == 0 || m.IsEmpty() {
 		return ""
 	}
 	//计算哈希值
@@ -78,3 +135,128 @@ func (m *Map) Get(key string) string {
 	//哈希环获取
 	return m.hashMap[m.keys[idx%len(m.keys)]]
 }
+
+//
+// GetN
+// @Description: 从key的位置顺时针返回至多n个不同的真实节点，第一个即Get的结果，其余为副本节点
+// @receiver m
+// @param key
+// @param n
+// @return []string
+//
+func (m *Map) GetN(key string, n int) []string {
+	if len(key) == 0 || m.IsEmpty() || n <= 0 {
+		return nil
+	}
+	if n > len(m.weights) {
+		n = len(m.weights)
+	}
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	nodes := make([]string, 0, n)
+	seen := make(map[string]bool, n)
+	for i := 0; i < len(m.keys) && len(nodes) < n; i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if !seen[node] {
+			seen[node] = true
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
+
+//
+// GetBounded
+// @Description: 有界负载的一致性哈希，从key的位置顺时针查找第一个未超出容量的节点。
+// 节点容量为ceil(factor*(总负载+1)*权重/总权重)，factor不小于1时总能找到节点，
+// 任何节点的负载都不会超过按权重分摊的平均负载的factor倍
+// @receiver m
+// @param key
+// @param factor 容量系数，如1.25
+// @param load 返回节点当前的负载
+// @return string
+//
+func (m *Map) GetBounded(key string, factor float64, load func(node string) int64) string {
+	if len(key) == 0 || m.IsEmpty() {
+		return ""
+	}
+	var total int64
+	totalWeight := 0
+	for node, weight := range m.weights {
+		total += load(node)
+		totalWeight += weight
+	}
+	hash := int(m.hash([]byte(key)))
+	idx := sort.Search(len(m.keys), func(i int) bool {
+		return m.keys[i] >= hash
+	})
+	checked := make(map[string]bool, len(m.weights))
+	for i := 0; i < len(m.keys) && len(checked) < len(m.weights); i++ {
+		node := m.hashMap[m.keys[(idx+i)%len(m.keys)]]
+		if checked[node] {
+			continue
+		}
+		checked[node] = true
+		capacity := math.Ceil(factor * float64(total+1) * float64(m.weights[node]) / float64(totalWeight))
+		if float64(load(node)+1) <= capacity {
+			return node
+		}
+	}
+	//factor小于1时可能所有节点都已满载，退化为普通一致性哈希
+	return m.hashMap[m.keys[idx%len(m.keys)]]
+}
+
+//
+// Remove
+// @Description: 根据节点名称删除节点及其全部虚拟节点
+// @receiver m
+// @param keys
+//
+func (m *Map) Remove(keys ...string) {
+	for _, key := range keys {
+		m.removeVirtual(key, 0, m.weights[key]*m.replicas)
+		delete(m.weights, key)
+	}
+}
+
+//
+// removeVirtual
+// @Description: 删除编号在[from, to)内的虚拟节点
+// @receiver m
+// @param key
+// @param from
+// @param to
+//
+func (m *Map) removeVirtual(key string, from, to int) {
+	removed := make(map[int]bool)
+	for i := from; i < to; i++ {
+		hash := int(m.hash([]byte(strconv.Itoa(i) + key)))
+		//虚拟节点哈希冲突时只删除属于该节点的映射
+		if m.hashMap[hash] == key {
+			delete(m.hashMap, hash)
+			removed[hash] = true
+		}
+	}
+	if len(removed) == 0 {
+		return
+	}
+	keep := m.keys[:0]
+	for _, hash := range m.keys {
+		if !removed[hash] {
+			keep = append(keep, hash)
+		}
+	}
+	m.keys = keep
+}
+
+//
+// IsEmpty
+// @Description: 哈希环上是否没有节点
+// @receiver m
+// @return bool
+//
+func (m *Map) IsEmpty() bool {
+	return len(m.keys) == 0
+}
@@ -1,6 +1,8 @@
 package consistenthash
 
 import (
+	"math"
+	"reflect"
 	"strconv"
 	"testing"
 )
@@ -32,3 +34,141 @@ func TestHash(t *testing.T) {
 		}
 	}
 }
+
+func TestRemove(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+
+	hash.Add("6", "4", "2", "8")
+	hash.Remove("8")
+	testCases := map[string]string{
+		"2":  "2",
+		"11": "2",
+		"23": "4",
+		"27": "2",
+	}
+	for k, v := range testCases {
+		if hash.Get(k) != v {
+			t.Errorf("required %s but %s", v, hash.Get(k))
+		}
+	}
+	hash.Remove("6", "4", "2")
+	if !hash.IsEmpty() || hash.Get("27") != "" {
+		t.Errorf("expected empty ring after removing all nodes")
+	}
+}
+
+func TestWeight(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("a")
+	hash.SetWeight("b", 4)
+	if hash.Weight("a") != 1 || hash.Weight("b") != 4 || len(hash.keys) != 250 {
+		t.Fatalf("unexpected weights a=%d b=%d with %d virtual nodes", hash.Weight("a"), hash.Weight("b"), len(hash.keys))
+	}
+
+	owners := func() map[string]string {
+		m := make(map[string]string, 10000)
+		for i := 0; i < 10000; i++ {
+			key := strconv.Itoa(i)
+			m[key] = hash.Get(key)
+		}
+		return m
+	}
+	before := owners()
+	counts := make(map[string]int)
+	for _, owner := range before {
+		counts[owner]++
+	}
+	if ratio := float64(counts["b"]) / float64(counts["a"]); ratio < 2.5 || ratio > 6 {
+		t.Fatalf("expected b to own about 4x the keys of a, got %v", counts)
+	}
+
+	//调高权重只会让b接管a的部分key，不会有key从b移走
+	hash.SetWeight("b", 8)
+	for key, owner := range owners() {
+		if before[key] == "b" && owner != "b" {
+			t.Fatalf("key %s moved away from b after increasing its weight", key)
+		}
+	}
+
+	//调回原权重后归属与调整前一致
+	hash.SetWeight("b", 4)
+	for key, owner := range owners() {
+		if before[key] != owner {
+			t.Fatalf("key %s owned by %s, want %s", key, owner, before[key])
+		}
+	}
+
+	hash.SetWeight("b", 0)
+	hash.Remove("a")
+	if !hash.IsEmpty() || hash.Weight("b") != 0 {
+		t.Fatalf("expected empty ring after removing all nodes")
+	}
+}
+
+func TestGetBounded(t *testing.T) {
+	hash := New(50, nil)
+	hash.Add("a", "b", "c", "d")
+	hash.SetWeight("e", 2)
+	const factor = 1.25
+	loads := make(map[string]int64)
+	load := func(node string) int64 {
+		return loads[node]
+	}
+
+	//八成请求集中在同一个热点key上
+	var total int64
+	for i := 0; i < 10000; i++ {
+		key := "hot"
+		if i%5 == 0 {
+			key = strconv.Itoa(i)
+		}
+		loads[hash.GetBounded(key, factor, load)]++
+		total++
+		for node, weight := range hash.weights {
+			capacity := int64(math.Ceil(factor * float64(total) * float64(weight) / 6))
+			if loads[node] > capacity {
+				t.Fatalf("node %s load %d exceeds capacity %d after %d requests", node, loads[node], capacity, total)
+			}
+		}
+	}
+	if hot := hash.Get("hot"); loads[hot] < total/6 {
+		t.Fatalf("expected hot key owner %s to be filled up, got loads %v", hot, loads)
+	}
+
+	//负载均衡时与普通一致性哈希结果一致
+	for node := range loads {
+		loads[node] = 0
+	}
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		if got, want := hash.GetBounded(key, factor, load), hash.Get(key); got != want {
+			t.Fatalf("key %s picked %s without load, want %s", key, got, want)
+		}
+	}
+}
+
+func TestGetN(t *testing.T) {
+	hash := New(3, func(key []byte) uint32 {
+		i, _ := strconv.Atoi(string(key))
+		return uint32(i)
+	})
+	//虚拟节点依次为2,4,6,12,14,16,22,24,26
+	hash.Add("6", "4", "2")
+	testCases := map[string][]string{
+		"2":  {"2", "4"},
+		"11": {"2", "4"},
+		"23": {"4", "6"},
+		"27": {"2", "4"},
+	}
+	for k, v := range testCases {
+		if got := hash.GetN(k, 2); !reflect.DeepEqual(got, v) {
+			t.Errorf("required %v but %v", v, got)
+		}
+	}
+	if got := hash.GetN("23", 5); !reflect.DeepEqual(got, []string{"4", "6", "2"}) {
+		t.Errorf("expected all nodes when n exceeds node count, got %v", got)
+	}
+}
@@ -0,0 +1,425 @@
+package diskcache
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	//单个段文件写满后切换到新文件
+	defaultSegmentBytes = 64 << 20
+	//段文件中仍有效的数据占比低于该值时压缩
+	compactRatio = 0.5
+	//记录头：校验和4字节、key长度4字节、value长度4字节、过期时间8字节
+	headerSize = 20
+	segmentExt = ".seg"
+)
+
+//
+// ErrTooLarge
+// @Description: 单条记录超出磁盘容量上限，无法写入
+//
+var ErrTooLarge = errors.New("diskcache: entry larger than store")
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+//
+// Store
+// @Description: 追加写的磁盘缓存，记录依次写入段文件，内存中只保存key到文件位置的索引。
+// 覆盖与删除只更新索引，有效数据占比过低的段文件在切换新文件时压缩，总大小超出上限时整段删除最早的段文件。
+// 进程重启期间错过的更新无法感知，Open时会清空目录中遗留的段文件
+//
+type Store struct {
+	dir string
+	//段文件总大小上限，0表示不限制
+	maxBytes int64
+	//单个段文件的大小
+	segmentBytes int64
+	mu           sync.RWMutex
+	//按创建顺序排列，最后一个为正在写入的段文件
+	segments []*segment
+	nextID   int
+	index    map[string]location
+	//段文件总大小
+	nbytes int64
+}
+
+//
+// segment
+// @Description: 一个段文件
+//
+type segment struct {
+	f    *os.File
+	size int64
+	//仍被索引引用的字节数
+	live int64
+}
+
+//
+// location
+// @Description: 记录在段文件中的位置
+//
+type location struct {
+	seg    *segment
+	offset int64
+	size   int64
+	expire time.Time
+}
+
+func (l location) expired(now time.Time) bool {
+	return !l.expire.IsZero() && !now.Before(l.expire)
+}
+
+//
+// Open
+// @Description: 在dir下创建磁盘缓存，dir不存在时自动创建
+// @param dir
+// @param maxBytes 段文件总大小上限，0表示不限制
+// @param segmentBytes 单个段文件的大小，不大于0时使用默认值
+// @return *Store
+// @return error
+//
+func Open(dir string, maxBytes, segmentBytes int64) (*Store, error) {
+	if segmentBytes <= 0 {
+		segmentBytes = defaultSegmentBytes
+	}
+	if maxBytes > 0 && segmentBytes > maxBytes {
+		segmentBytes = maxBytes
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	stale, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range stale {
+		if err = os.Remove(name); err != nil {
+			return nil, err
+		}
+	}
+	return &Store{
+		dir:          dir,
+		maxBytes:     maxBytes,
+		segmentBytes: segmentBytes,
+		index:        make(map[string]location),
+	}, nil
+}
+
+//
+// Get
+// @Description: 读取记录，校验和不一致或已过期时视为不存在
+// @receiver s
+// @param key
+// @return value
+// @return expire
+// @return ok
+//
+func (s *Store) Get(key string) (value []byte, expire time.Time, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	loc, ok := s.index[key]
+	if !ok || loc.expired(time.Now()) {
+		return nil, time.Time{}, false
+	}
+	k, value, err := s.read(loc)
+	if err != nil || k != key {
+		return nil, time.Time{}, false
+	}
+	return value, loc.expire, true
+}
+
+//
+// Put
+// @Description: 追加写入一条记录，已过期的记录直接忽略
+// @receiver s
+// @param key
+// @param value
+// @param expire 零值表示永不过期
+// @return error
+//
+func (s *Store) Put(key string, value []byte, expire time.Time) error {
+	if !expire.IsZero() && !time.Now().Before(expire) {
+		return nil
+	}
+	size := int64(headerSize + len(key) + len(value))
+	if s.maxBytes > 0 && size > s.maxBytes {
+		return ErrTooLarge
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rotated, err := s.append(key, value, expire)
+	if err != nil {
+		return err
+	}
+	if rotated {
+		s.compact()
+	}
+	s.enforce()
+	return nil
+}
+
+//
+// Remove
+// @Description: 删除记录，只更新索引，段文件中的数据在压缩时回收
+// @receiver s
+// @param key
+//
+func (s *Store) Remove(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if loc, ok := s.index[key]; ok {
+		delete(s.index, key)
+		s.release(loc)
+	}
+}
+
+//
+// Len
+// @Description: 记录条数，包括尚未清理的过期记录
+// @receiver s
+// @return int
+//
+func (s *Store) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.index)
+}
+
+//
+// Bytes
+// @Description: 段文件总大小
+// @receiver s
+// @return int64
+//
+func (s *Store) Bytes() int64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.nbytes
+}
+
+//
+// Close
+// @Description: 关闭并删除全部段文件
+// @receiver s
+// @return error
+//
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstErr error
+	for _, seg := range s.segments {
+		if err := s.drop(seg); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.segments = nil
+	s.index = make(map[string]location)
+	return firstErr
+}
+
+//
+// append
+// @Description: 写入正在写入的段文件，写满时先切换新文件，调用方需持有写锁
+// @receiver s
+// @param key
+// @param value
+// @param expire
+// @return rotated 是否切换了新文件
+// @return err
+//
+func (s *Store) append(key string, value []byte, expire time.Time) (rotated bool, err error) {
+	size := int64(headerSize + len(key) + len(value))
+	active := s.active()
+	if active == nil || (active.size > 0 && active.size+size > s.segmentBytes) {
+		if active, err = s.rotate(); err != nil {
+			return false, err
+		}
+		rotated = true
+	}
+	buf := make([]byte, size)
+	binary.BigEndian.PutUint32(buf[4:], uint32(len(key)))
+	binary.BigEndian.PutUint32(buf[8:], uint32(len(value)))
+	var nano int64
+	if !expire.IsZero() {
+		nano = expire.UnixNano()
+	}
+	binary.BigEndian.PutUint64(buf[12:], uint64(nano))
+	copy(buf[headerSize:], key)
+	copy(buf[headerSize+len(key):], value)
+	binary.BigEndian.PutUint32(buf, crc32.Checksum(buf[4:], crcTable))
+	//写入失败时不更新size，下次写入覆盖不完整的数据
+	if _, err = active.f.WriteAt(buf, active.size); err != nil {
+		return rotated, err
+	}
+	if old, ok := s.index[key]; ok {
+		s.release(old)
+	}
+	s.index[key] = location{seg: active, offset: active.size, size: size, expire: expire}
+	active.size += size
+	active.live += size
+	s.nbytes += size
+	return rotated, nil
+}
+
+//
+// read
+// @Description: 读取并校验一条记录
+// @receiver s
+// @param loc
+// @return key
+// @return value
+// @return err
+//
+func (s *Store) read(loc location) (key string, value []byte, err error) {
+	buf := make([]byte, loc.size)
+	if _, err = loc.seg.f.ReadAt(buf, loc.offset); err != nil {
+		return "", nil, err
+	}
+	if crc32.Checksum(buf[4:], crcTable) != binary.BigEndian.Uint32(buf) {
+		return "", nil, fmt.Errorf("diskcache: checksum mismatch at %s:%d", loc.seg.f.Name(), loc.offset)
+	}
+	keyLen := int64(binary.BigEndian.Uint32(buf[4:]))
+	return string(buf[headerSize : headerSize+keyLen]), buf[headerSize+keyLen:], nil
+}
+
+//
+// active
+// @Description: 正在写入的段文件，没有段文件时返回nil
+// @receiver s
+// @return *segment
+//
+func (s *Store) active() *segment {
+	if len(s.segments) == 0 {
+		return nil
+	}
+	return s.segments[len(s.segments)-1]
+}
+
+//
+// rotate
+// @Description: 创建新的段文件作为正在写入的段文件
+// @receiver s
+// @return *segment
+// @return error
+//
+func (s *Store) rotate() (*segment, error) {
+	s.nextID++
+	name := filepath.Join(s.dir, fmt.Sprintf("%08d%s", s.nextID, segmentExt))
+	f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+	seg := &segment{f: f}
+	s.segments = append(s.segments, seg)
+	return seg, nil
+}
+
+//
+// release
+// @Description: 记录被覆盖或删除后扣减所在段文件的有效字节数，段文件不再有有效数据时立即删除
+// @receiver s
+// @param loc
+//
+func (s *Store) release(loc location) {
+	loc.seg.live -= loc.size
+	if loc.seg.live == 0 && loc.seg != s.active() {
+		s.remove(loc.seg)
+	}
+}
+
+//
+// compact
+// @Description: 将有效数据占比过低的段文件中未过期的记录写入正在写入的段文件，再删除原文件
+// @receiver s
+//
+func (s *Store) compact() {
+	now := time.Now()
+	//只压缩本次开始前已写满的段文件
+	candidates := make([]*segment, 0, len(s.segments))
+	for _, seg := range s.segments[:len(s.segments)-1] {
+		if float64(seg.live) < float64(seg.size)*compactRatio {
+			candidates = append(candidates, seg)
+		}
+	}
+	for _, seg := range candidates {
+		for key, loc := range s.index {
+			if loc.seg != seg {
+				continue
+			}
+			if loc.expired(now) {
+				delete(s.index, key)
+				seg.live -= loc.size
+				continue
+			}
+			_, value, err := s.read(loc)
+			if err != nil {
+				delete(s.index, key)
+				seg.live -= loc.size
+				continue
+			}
+			//写入失败时保留原文件，等待下次压缩
+			if _, err = s.append(key, value, loc.expire); err != nil {
+				return
+			}
+		}
+		if seg.live == 0 {
+			s.remove(seg)
+		}
+	}
+}
+
+//
+// enforce
+// @Description: 总大小超出上限时从最早的段文件开始整段删除，其中的记录一并淘汰
+// @receiver s
+//
+func (s *Store) enforce() {
+	for s.maxBytes > 0 && s.nbytes > s.maxBytes && len(s.segments) > 1 {
+		oldest := s.segments[0]
+		for key, loc := range s.index {
+			if loc.seg == oldest {
+				delete(s.index, key)
+			}
+		}
+		s.remove(oldest)
+	}
+}
+
+//
+// remove
+// @Description: 从段文件列表中移除并删除段文件，已移除的段文件会被忽略
+// @receiver s
+// @param seg
+//
+func (s *Store) remove(seg *segment) {
+	for i, other := range s.segments {
+		if other == seg {
+			s.segments = append(s.segments[:i], s.segments[i+1:]...)
+			s.drop(seg)
+			return
+		}
+	}
+}
+
+//
+// drop
+// @Description: 关闭并删除段文件
+// @receiver s
+// @param seg
+// @return error
+//
+func (s *Store) drop(seg *segment) error {
+	s.nbytes -= seg.size
+	err := seg.f.Close()
+	if rerr := os.Remove(seg.f.Name()); err == nil {
+		err = rerr
+	}
+	return err
+}
@@ -0,0 +1,142 @@
+package diskcache
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func segmentFiles(t *testing.T, dir string) []string {
+	files, err := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestPutGet(t *testing.T) {
+	dir := t.TempDir()
+	//遗留的段文件在Open时清空
+	if err := os.WriteFile(filepath.Join(dir, "00000001"+segmentExt), []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := Open(dir, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, _, ok := s.Get("k1"); ok {
+		t.Fatalf("expected leftover segments to be discarded")
+	}
+	expire := time.Now().Add(time.Hour)
+	s.Put("k1", []byte("v1"), expire)
+	s.Put("k2", []byte("v2"), time.Time{})
+	s.Put("k1", []byte("v1-new"), time.Time{})
+	s.Put("gone", []byte("v"), time.Now().Add(-time.Second))
+	if v, e, ok := s.Get("k1"); !ok || string(v) != "v1-new" || !e.IsZero() {
+		t.Fatalf("expected overwritten value, got %q %v %v", v, e, ok)
+	}
+	if v, _, ok := s.Get("k2"); !ok || string(v) != "v2" {
+		t.Fatalf("expected k2, got %q %v", v, ok)
+	}
+	if _, _, ok := s.Get("gone"); ok {
+		t.Fatalf("expected expired entry to be ignored")
+	}
+	s.Remove("k2")
+	if _, _, ok := s.Get("k2"); ok || s.Len() != 1 {
+		t.Fatalf("expected k2 to be removed, %d entries left", s.Len())
+	}
+	if err = s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if files := segmentFiles(t, dir); len(files) != 0 {
+		t.Fatalf("expected segments to be deleted on close, got %v", files)
+	}
+}
+
+func TestCorruptRecord(t *testing.T) {
+	s, err := Open(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Put("key", []byte("value"), time.Time{})
+	loc := s.index["key"]
+	if _, err = loc.seg.f.WriteAt([]byte("X"), loc.offset+loc.size-1); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := s.Get("key"); ok {
+		t.Fatalf("expected checksum mismatch to be treated as a miss")
+	}
+}
+
+func TestCompact(t *testing.T) {
+	dir := t.TempDir()
+	//每条记录20+2+8=30字节，每个段文件存放3条
+	s, err := Open(dir, 0, 90)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	value := []byte("01234567")
+	for i := 0; i < 3; i++ {
+		s.Put("a"+strconv.Itoa(i), value, time.Time{})
+	}
+	//第一个段文件只剩a0有效
+	s.Remove("a1")
+	s.Remove("a2")
+	if len(s.segments) != 1 {
+		t.Fatalf("expected the active segment to be kept, got %d segments", len(s.segments))
+	}
+	//写满后切换新文件并压缩第一个段文件
+	s.Put("b0", value, time.Time{})
+	if files := segmentFiles(t, dir); len(files) != 1 {
+		t.Fatalf("expected compacted segment to be deleted, got %v", files)
+	}
+	for _, key := range []string{"a0", "b0"} {
+		if v, _, ok := s.Get(key); !ok || string(v) != string(value) {
+			t.Fatalf("expected %s to survive compaction, got %q %v", key, v, ok)
+		}
+	}
+	if s.Bytes() != 60 {
+		t.Fatalf("expected 60 bytes after compaction, got %d", s.Bytes())
+	}
+
+	//段文件中的记录全部被删除时立即回收
+	s.Put("b1", value, time.Time{})
+	s.Put("c0", value, time.Time{})
+	for _, key := range []string{"a0", "b0", "b1"} {
+		s.Remove(key)
+	}
+	if files := segmentFiles(t, dir); len(files) != 1 || s.Len() != 1 {
+		t.Fatalf("expected only the active segment with c0, got %v and %d entries", files, s.Len())
+	}
+}
+
+func TestBudget(t *testing.T) {
+	dir := t.TempDir()
+	s, err := Open(dir, 90, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	value := []byte("01234567")
+	for i := 0; i < 6; i++ {
+		s.Put("k"+strconv.Itoa(i), value, time.Time{})
+		if s.Bytes() > 90 {
+			t.Fatalf("store exceeds its budget: %d bytes", s.Bytes())
+		}
+	}
+	//超出上限时整段删除最早的段文件
+	for i := 0; i < 6; i++ {
+		_, _, ok := s.Get("k" + strconv.Itoa(i))
+		if ok != (i >= 4) {
+			t.Fatalf("unexpected presence of k%d: %v", i, ok)
+		}
+	}
+	if err = s.Put("big", make([]byte, 100), time.Time{}); err != ErrTooLarge {
+		t.Fatalf("expected ErrTooLarge, got %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	pb "gocache/gocachepb"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+)
+
+//
+// ErrNotFound
+// @Description: key不存在，回调函数应返回该错误或包装了该错误的error，
+// 归属节点给出的该结论是权威的，调用方不会再退化为本地加载
+//
+var ErrNotFound = errors.New("gocache: key not found")
+
+//
+// remoteError
+// @Description: 远程节点返回的错误，NOT_FOUND可通过errors.Is(err, ErrNotFound)识别
+//
+type remoteError struct {
+	code pb.Code
+	msg  string
+}
+
+func (e *remoteError) Error() string {
+	return e.msg
+}
+
+func (e *remoteError) Unwrap() error {
+	if e.code == pb.Code_NOT_FOUND {
+		return ErrNotFound
+	}
+	return nil
+}
+
+//
+// errorCode
+// @Description: 将本地错误归类为传输用的错误类型
+// @param err
+// @return pb.Code
+//
+func errorCode(err error) pb.Code {
+	switch {
+	case err == nil:
+		return pb.Code_OK
+	case errors.Is(err, ErrNotFound):
+		return pb.Code_NOT_FOUND
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, context.Canceled):
+		return pb.Code_UNAVAILABLE
+	default:
+		return pb.Code_INTERNAL
+	}
+}
+
+//
+// errorResponse
+// @Description: 将错误封装为Response
+// @param err
+// @return *pb.Response
+//
+func errorResponse(err error) *pb.Response {
+	return &pb.Response{Error: err.Error(), Code: errorCode(err)}
+}
+
+//
+// responseError
+// @Description: 从Response中还原错误，成功时返回nil
+// @param res
+// @return error
+//
+func responseError(res *pb.Response) error {
+	code := res.GetCode()
+	if code == pb.Code_OK {
+		if res.GetError() == "" {
+			return nil
+		}
+		code = pb.Code_INTERNAL
+	}
+	return &remoteError{code: code, msg: res.GetError()}
+}
+
+//
+// httpStatus
+// @Description: 错误类型对应的http状态码
+// @param code
+// @return int
+//
+func httpStatus(code pb.Code) int {
+	switch code {
+	case pb.Code_OK:
+		return http.StatusOK
+	case pb.Code_NOT_FOUND:
+		return http.StatusNotFound
+	case pb.Code_UNAVAILABLE:
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+//
+// grpcStatus
+// @Description: 将错误转换为gRPC状态
+// @param err
+// @return error
+//
+func grpcStatus(err error) error {
+	switch errorCode(err) {
+	case pb.Code_NOT_FOUND:
+		return status.Error(codes.NotFound, err.Error())
+	case pb.Code_UNAVAILABLE:
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+//
+// fromGRPCStatus
+// @Description: 从gRPC状态中还原NOT_FOUND，其余错误原样返回
+// @param err
+// @return error
+//
+func fromGRPCStatus(err error) error {
+	if s, ok := status.FromError(err); ok && s.Code() == codes.NotFound {
+		return &remoteError{code: pb.Code_NOT_FOUND, msg: s.Message()}
+	}
+	return err
+}
@@ -1,23 +1,63 @@
 package gocache
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	pb "gocache/gocachepb"
 	"gocache/singleflight"
-	"log"
+	"math/rand"
 	"sync"
+	"time"
 )
 
+//
+// Getter
+// @Description: 缓存未命中时的数据回调，ctx携带调用方的截止时间与取消信号
+//
 type Getter interface {
-	Get(key string) ([]byte, error)
+	Get(ctx context.Context, key string) ([]byte, error)
 }
 
+//
+// GetterFunc
+// @Description: 不关心ctx的回调函数适配器
+//
 type GetterFunc func(key string) ([]byte, error)
 
-func (f GetterFunc) Get(key string) ([]byte, error) {
+func (f GetterFunc) Get(_ context.Context, key string) ([]byte, error) {
 	return f(key)
 }
 
+//
+// ContextGetterFunc
+// @Description: 携带ctx的回调函数适配器
+//
+type ContextGetterFunc func(ctx context.Context, key string) ([]byte, error)
+
+func (f ContextGetterFunc) Get(ctx context.Context, key string) ([]byte, error) {
+	return f(ctx, key)
+}
+
+//
+// TTLGetter
+// @Description: 可选实现，回调时同时返回该条数据的过期时长，覆盖Group的默认值
+//
+type TTLGetter interface {
+	GetWithTTL(ctx context.Context, key string) ([]byte, time.Duration, error)
+}
+
+type TTLGetterFunc func(ctx context.Context, key string) ([]byte, time.Duration, error)
+
+func (f TTLGetterFunc) Get(ctx context.Context, key string) ([]byte, error) {
+	bytes, _, err := f(ctx, key)
+	return bytes, err
+}
+
+func (f TTLGetterFunc) GetWithTTL(ctx context.Context, key string) ([]byte, time.Duration, error) {
+	return f(ctx, key)
+}
+
 //
 // Group
 // @Description: 一个缓存的命名空间，拥有唯一名称
@@ -27,14 +67,51 @@ type Group struct {
 	name string
 	//缓存未命中时进行回调获取数据
 	getter Getter
-	//缓存
+	//缓存，保存本节点负责的key
 	mainCache cache
+	//二级缓存，保存主缓存淘汰的记录，nil表示不开启
+	l2 L2Cache
+	//热点缓存，抽样保存从远程节点获取的key，避免热点key每次都跨网络访问
+	hotCache cache
+	//热点缓存占cacheBytes的比例，0表示不开启
+	hotCacheRatio float64
+	//负缓存，短时间内记住不存在的key，与mainCache分开计算容量
+	negativeCache cache
+	//负缓存有效期，0表示不开启
+	negativeTTL time.Duration
+	//过期后仍可返回旧值的时长，0表示不开启
+	stale time.Duration
+	//生命周期最后refreshAhead比例内被访问时提前刷新，0表示不开启
+	refreshAhead float64
+	//后台刷新的并发上限
+	maxRefreshes int
+	//后台刷新的并发信号量，未开启刷新时为nil
+	refreshes  chan struct{}
+	refreshMu  sync.Mutex
+	refreshing map[string]struct{}
+	//统计信息
+	stats groupStats
+	//回调加载耗时
+	loadLatency histogram
 	//远程数据获取接口
 	peers PeerPicker
 	//并发处理请求策略
 	loader *singleflight.Group
+	//默认缓存过期时长，0表示永不过期
+	expiration time.Duration
+	//共享加载的超时上限，0表示使用defaultLoadTimeout
+	loadTimeout time.Duration
+	//分级日志，默认不输出请求级别的日志
+	logger Logger
 }
 
+const (
+	//共享加载的默认超时时长
+	defaultLoadTimeout = 30 * time.Second
+	//负缓存未指定容量时的默认上限
+	defaultNegativeCacheBytes = 1 << 20
+)
+
 var (
 	mu     sync.RWMutex
 	groups = make(map[string]*Group)
@@ -46,9 +123,10 @@ var (
 // @param name
 // @param cacheBytes
 // @param getter
+// @param opts
 // @return *Group
 //
-func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
+func NewGroup(name string, cacheBytes int64, getter Getter, opts ...GroupOption) *Group {
 	if getter == nil {
 		panic("nil Getter")
 	}
@@ -59,6 +137,51 @@ func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
 		mainCache: cache{cacheBytes: cacheBytes},
 		getter:    getter,
 		loader:    &singleflight.Group{},
+		logger:    defaultLogger,
+	}
+	for _, opt := range opts {
+		opt(g)
+	}
+	if g.hotCacheRatio < 0 || g.hotCacheRatio >= 1 {
+		panic("hot cache ratio must be in (0, 1)")
+	}
+	if g.refreshAhead < 0 || g.refreshAhead >= 1 {
+		panic("refresh ahead fraction must be in (0, 1)")
+	}
+	if g.mainCache.maxEntryBytes < 0 || cacheBytes > 0 && g.mainCache.maxEntryBytes > cacheBytes {
+		panic("max entry bytes must be in [0, cacheBytes]")
+	}
+	if g.hotCacheRatio > 0 {
+		hotBytes := int64(float64(cacheBytes) * g.hotCacheRatio)
+		//容量为0表示不限制，有容量限制时两者至少各保留1字节，避免按比例划分后变为不限制
+		if cacheBytes > 0 {
+			if hotBytes < 1 {
+				hotBytes = 1
+			}
+			g.mainCache.cacheBytes = cacheBytes - hotBytes
+			if g.mainCache.cacheBytes < 1 {
+				g.mainCache.cacheBytes = 1
+			}
+		}
+		g.hotCache.cacheBytes = hotBytes
+		g.hotCache.sweepInterval = g.mainCache.sweepInterval
+	}
+	if g.negativeTTL > 0 {
+		g.negativeCache.sweepInterval = g.mainCache.sweepInterval
+		if g.negativeCache.cacheBytes <= 0 {
+			g.negativeCache.cacheBytes = defaultNegativeCacheBytes
+		}
+	}
+	if g.l2 != nil {
+		g.mainCache.onEvicted = g.spill
+	}
+	if g.stale > 0 || g.refreshAhead > 0 {
+		g.mainCache.stale, g.hotCache.stale = g.stale, g.stale
+		if g.maxRefreshes <= 0 {
+			g.maxRefreshes = defaultMaxRefreshes
+		}
+		g.refreshes = make(chan struct{}, g.maxRefreshes)
+		g.refreshing = make(map[string]struct{})
 	}
 	groups[name] = g
 	return g
@@ -71,6 +194,9 @@ func NewGroup(name string, cacheBytes int64, getter Getter) *Group {
 // @param peers
 //
 func (g *Group) RegisterPeers(peers PeerPicker) {
+	//加锁与后台交接遍历Group时的读取互斥
+	mu.Lock()
+	defer mu.Unlock()
 	if g.peers != nil {
 		panic("register PeerPicker called more than once")
 	}
@@ -81,22 +207,81 @@ func (g *Group) RegisterPeers(peers PeerPicker) {
 // getFromPeer
 // @Description: 实现访问远程节点的再一次封装
 // @receiver g
+// @param ctx
 // @param peer
 // @param key
 // @return ByteView
 // @return error
 //
-func (g *Group) getFromPeer(peer PeerGetter, key string) (ByteView, error) {
+func (g *Group) getFromPeer(ctx context.Context, peer PeerGetter, key string) (ByteView, error) {
 	req := &pb.Request{
-		Group: g.name,
-		Key:   key,
+		Group:     g.name,
+		Key:       key,
+		Forwarded: true,
 	}
 	res := &pb.Response{}
-	err := peer.Get(req, res)
+	err := peer.Get(ctx, req, res)
+	if err == nil {
+		err = responseError(res)
+	}
 	if err != nil {
+		//key不存在是归属节点的正常应答
+		if errors.Is(err, ErrNotFound) {
+			g.populateNegative(key)
+		} else {
+			g.stats.peerErrors.Add(1)
+		}
 		return ByteView{}, err
 	}
-	return ByteView{res.Value}, err
+	g.stats.peerLoads.Add(1)
+	value := ByteView{b: res.Value, e: fromUnixNano(res.Expire), l: time.Now()}
+	g.populateHotCache(key, value)
+	return value, nil
+}
+
+//
+// forwardedKey
+// @Description: ctx中标记请求由其余节点转发而来的键
+//
+type forwardedKey struct{}
+
+//
+// withForwarded
+// @Description: forwarded为true时标记请求由其余节点转发而来，本节点直接加载，不再选择节点。
+// 发送方已按自己的视角选定本节点，再次选择会把有界负载顺延的请求送回归属节点，节点视角不一致时还可能来回转发
+// @param ctx
+// @param forwarded
+// @return context.Context
+//
+func withForwarded(ctx context.Context, forwarded bool) context.Context {
+	if !forwarded {
+		return ctx
+	}
+	return context.WithValue(ctx, forwardedKey{}, true)
+}
+
+//
+// isForwarded
+// @Description: 请求是否由其余节点转发而来
+// @param ctx
+// @return bool
+//
+func isForwarded(ctx context.Context) bool {
+	forwarded, _ := ctx.Value(forwardedKey{}).(bool)
+	return forwarded
+}
+
+//
+// populateHotCache
+// @Description: 抽样放入热点缓存，访问越频繁的key越可能被选中
+// @receiver g
+// @param key
+// @param value
+//
+func (g *Group) populateHotCache(key string, value ByteView) {
+	if g.hotCacheRatio > 0 && rand.Intn(hotCacheSampling) == 0 {
+		g.hotCache.add(key, value)
+	}
 }
 
 //
@@ -112,6 +297,22 @@ func GetGroup(name string) *Group {
 	return g
 }
 
+//
+// Close
+// @Description: 停止各级缓存的后台清理并从全局注册表中移除，关闭后不应再使用该Group
+// @receiver g
+//
+func (g *Group) Close() {
+	mu.Lock()
+	if groups[g.name] == g {
+		delete(groups, g.name)
+	}
+	mu.Unlock()
+	g.mainCache.close()
+	g.hotCache.close()
+	g.negativeCache.close()
+}
+
 //
 // Get
 // @Description: 获取缓存
@@ -121,39 +322,92 @@ func GetGroup(name string) *Group {
 // @return error
 //
 func (g *Group) Get(key string) (ByteView, error) {
+	return g.GetContext(context.Background(), key)
+}
+
+//
+// GetContext
+// @Description: 获取缓存，ctx的截止时间与取消信号会传递至远程节点及回调函数
+// @receiver g
+// @param ctx
+// @param key
+// @return ByteView
+// @return error
+//
+func (g *Group) GetContext(ctx context.Context, key string) (ByteView, error) {
+	g.stats.gets.Add(1)
 	if key == "" {
 		return ByteView{}, fmt.Errorf("requires key")
 	}
-	if v, ok := g.mainCache.get(key); ok {
-		log.Println("[GoCache] hit")
+	if v, ok := g.lookupCache(key); ok {
+		g.logKey(LevelDebug, "cache hit", key)
 		return v, nil
 	}
-	return g.load(key)
+	if g.lookupNegative(key) {
+		return ByteView{}, ErrNotFound
+	}
+	if err := ctx.Err(); err != nil {
+		return ByteView{}, err
+	}
+	return g.load(ctx, key)
 }
 
 //
 // load
 // @Description: 缓存获取逻辑,首先尝试从远程拿缓存，其次再考虑本地取数据
 // @receiver g
+// @param ctx
 // @param key
 // @return value
 // @return err
 //
-func (g *Group) load(key string) (value ByteView, err error) {
+func (g *Group) load(ctx context.Context, key string) (value ByteView, err error) {
 	//本地缓存不命中
-	//并发处理
-	viewi, err := g.loader.Do(key, func() (interface{}, error) {
-		if g.peers != nil {
-			//一致性哈希选取节点
-			if peer, ok := g.peers.PickPeer(key); ok {
-				//远程调用数据
-				if value, err = g.getFromPeer(peer, key); err != nil {
-					return value, nil
+	g.stats.loads.Add(1)
+	forwarded := isForwarded(ctx)
+	ctx, cancel := g.loadContext(ctx)
+	defer cancel()
+	//并发处理，每个调用方可通过ctx单独放弃等待，共享的加载不受发起者取消的影响，截止时间取各调用方中最晚者
+	viewi, err, _ := g.loader.DoContext(ctx, key, func(ctx context.Context) (interface{}, error) {
+		g.stats.loadsDeduped.Add(1)
+		//按优先级依次向副本节点查询，轮到本节点时本地加载，转发而来的请求直接本地加载
+		replicas := []PeerGetter{nil}
+		if !forwarded {
+			replicas = g.pickReplicas(key)
+		}
+		//本节点不再是副本时二级缓存中的记录可能已过时，丢弃后向新的副本节点查询
+		if !hasLocal(replicas) {
+			g.dropL2(key)
+		} else if value, ok := g.lookupL2(key); ok {
+			return value, nil
+		}
+		for i, peer := range replicas {
+			if peer == nil {
+				break
+			}
+			//远程调用数据
+			start := time.Now()
+			value, err := g.getFromPeer(ctx, peer, key)
+			if err == nil {
+				g.logKey(LevelDebug, "loaded from peer", key, Field{"peer", peer}, Field{"latency", time.Since(start)})
+				//本节点同为副本时保存到主缓存
+				if hasLocal(replicas[i+1:]) {
+					g.populateCache(key, value)
 				}
-				log.Println("[gocache] Failed to get remote data from peer :", peer)
+				return value, nil
 			}
+			//副本节点确认key不存在或加载已超时时不再继续
+			if errors.Is(err, ErrNotFound) || ctx.Err() != nil {
+				return nil, err
+			}
+			g.logKey(LevelWarn, "failed to load from peer", key,
+				Field{"peer", peer}, Field{"latency", time.Since(start)}, Field{"err", err})
+		}
+		value, err := g.getLocally(ctx, key)
+		if err == nil {
+			g.replicate(key, value, replicas)
 		}
-		return g.getLocally(key)
+		return value, err
 	})
 	if err == nil {
 		return viewi.(ByteView), nil
@@ -161,18 +415,340 @@ func (g *Group) load(key string) (value ByteView, err error) {
 	return
 }
 
-func (g *Group) getLocally(key string) (ByteView, error) {
+//
+// loadContext
+// @Description: 将调用方的截止时间限制在Group的加载超时之内，调用方没有截止时间时以加载超时为准
+// @receiver g
+// @param ctx
+// @return context.Context
+// @return context.CancelFunc
+//
+func (g *Group) loadContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	timeout := g.loadTimeout
+	if timeout <= 0 {
+		timeout = defaultLoadTimeout
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func (g *Group) getLocally(ctx context.Context, key string) (ByteView, error) {
 	//回调数据
-	bytes, err := g.getter.Get(key)
+	var (
+		bytes []byte
+		ttl   time.Duration
+		err   error
+	)
+	start := time.Now()
+	if getter, ok := g.getter.(TTLGetter); ok {
+		bytes, ttl, err = getter.GetWithTTL(ctx, key)
+	} else {
+		bytes, err = g.getter.Get(ctx, key)
+	}
+	latency := time.Since(start)
+	g.loadLatency.observe(latency)
 	if err != nil {
+		g.stats.localLoadErrs.Add(1)
+		if errors.Is(err, ErrNotFound) {
+			g.populateNegative(key)
+		}
 		return ByteView{}, err
 	}
+	g.stats.localLoads.Add(1)
+	g.logKey(LevelDebug, "loaded locally", key, Field{"latency", latency})
 	//填充本地缓存
-	value := ByteView{b: cloneBytes(bytes)}
+	value := ByteView{b: cloneBytes(bytes), e: g.expireAt(ttl), l: time.Now()}
 	g.populateCache(key, value)
 	return value, nil
 }
 
 func (g *Group) populateCache(key string, value ByteView) {
+	//先删除二级缓存中的旧值，写入时若被淘汰会重新写入二级缓存
+	if g.l2 != nil {
+		g.l2.Remove(key)
+	}
 	g.mainCache.add(key, value)
+	g.negativeCache.remove(key)
+}
+
+//
+// populateFromPeer
+// @Description: 写入远程节点发来的值，IfAbsent时不覆盖本节点已有的值
+// @receiver g
+// @param key
+// @param req
+//
+func (g *Group) populateFromPeer(key string, req *pb.SetRequest) {
+	value := ByteView{b: cloneBytes(req.GetValue()), e: fromUnixNano(req.GetExpire())}
+	if !req.GetIfAbsent() {
+		g.populateCache(key, value)
+		return
+	}
+	if g.mainCache.addIfAbsent(key, value) {
+		if g.l2 != nil {
+			g.l2.Remove(key)
+		}
+		g.negativeCache.remove(key)
+	}
+}
+
+//
+// lookupCache
+// @Description: 依次在主缓存与热点缓存中查找，命中旧值或临近过期的值时触发后台刷新
+// @receiver g
+// @param key
+// @return value
+// @return ok
+//
+func (g *Group) lookupCache(key string) (value ByteView, ok bool) {
+	if value, ok = g.mainCache.get(key); ok {
+		g.stats.cacheHits.Add(1)
+		g.maybeRefresh(key, value)
+		return
+	}
+	if g.hotCacheRatio == 0 {
+		return
+	}
+	if value, ok = g.hotCache.get(key); ok {
+		g.stats.cacheHits.Add(1)
+		g.stats.hotHits.Add(1)
+		g.maybeRefresh(key, value)
+	}
+	return
+}
+
+//
+// removeLocally
+// @Description: 删除本节点主缓存、二级缓存、热点缓存与负缓存中的key
+// @receiver g
+// @param key
+//
+func (g *Group) removeLocally(key string) {
+	g.mainCache.remove(key)
+	if g.l2 != nil {
+		g.l2.Remove(key)
+	}
+	g.hotCache.remove(key)
+	g.negativeCache.remove(key)
+}
+
+//
+// CacheType
+// @Description: Group内的缓存类型
+//
+type CacheType int
+
+const (
+	//本节点负责的key
+	MainCache CacheType = iota + 1
+	//从远程节点抽样保存的热点key
+	HotCache
+	//确认不存在的key
+	NegativeCache
+)
+
+//
+// CacheStats
+// @Description: 返回指定缓存的统计信息
+// @receiver g
+// @param which
+// @return CacheStats
+//
+func (g *Group) CacheStats(which CacheType) CacheStats {
+	switch which {
+	case MainCache:
+		return g.mainCache.stats()
+	case HotCache:
+		return g.hotCache.stats()
+	case NegativeCache:
+		return g.negativeCache.stats()
+	default:
+		return CacheStats{}
+	}
+}
+
+//
+// expireAt
+// @Description: 计算过期时间，ttl不大于0时使用Group的默认过期时长
+// @receiver g
+// @param ttl
+// @return time.Time
+//
+func (g *Group) expireAt(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		ttl = g.expiration
+	}
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+//
+// Set
+// @Description: 主动写入缓存，路由至key的归属节点进行更新
+// @receiver g
+// @param key
+// @param value
+// @return error
+//
+func (g *Group) Set(key string, value []byte) error {
+	if key == "" {
+		return fmt.Errorf("requires key")
+	}
+	view := ByteView{b: cloneBytes(value), e: g.expireAt(0), l: time.Now()}
+	req := &pb.SetRequest{
+		Group:  g.name,
+		Key:    key,
+		Value:  view.b,
+		Expire: toUnixNano(view.e),
+	}
+	var firstErr error
+	replicas := g.pickReplicas(key)
+	for _, peer := range replicas {
+		if peer == nil {
+			g.populateCache(key, view)
+			continue
+		}
+		if err := peer.Set(context.Background(), req, &pb.Response{}); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if !hasLocal(replicas) {
+		//本节点的热点缓存与负缓存副本已过时
+		g.hotCache.remove(key)
+		g.negativeCache.remove(key)
+	}
+	return firstErr
+}
+
+//
+// Remove
+// @Description: 主动删除缓存，路由至key的归属节点进行删除
+// @receiver g
+// @param key
+// @return error
+//
+func (g *Group) Remove(key string) error {
+	if key == "" {
+		return fmt.Errorf("requires key")
+	}
+	req := &pb.Request{
+		Group: g.name,
+		Key:   key,
+	}
+	var firstErr error
+	replicas := g.pickReplicas(key)
+	for _, peer := range replicas {
+		if peer == nil {
+			g.removeLocally(key)
+			continue
+		}
+		if err := peer.Remove(context.Background(), req, &pb.Response{}); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	if !hasLocal(replicas) {
+		g.hotCache.remove(key)
+		g.negativeCache.remove(key)
+	}
+	return firstErr
+}
+
+//
+// Invalidate
+// @Description: 使key在本节点以及归属节点上的缓存失效，下一次Get将重新加载
+// @receiver g
+// @param key
+// @return error
+//
+func (g *Group) Invalidate(key string) error {
+	if key == "" {
+		return fmt.Errorf("requires key")
+	}
+	//节点变更后本节点可能仍保留着旧的缓存，先行清除
+	g.removeLocally(key)
+	return g.Remove(key)
+}
+
+//
+// pickPeer
+// @Description: 选取key的归属节点，归属本节点时返回false
+// @receiver g
+// @param key
+// @return PeerGetter
+// @return bool
+//
+func (g *Group) pickPeer(key string) (PeerGetter, bool) {
+	if g.peers == nil {
+		return nil, false
+	}
+	return g.peers.PickPeer(key)
+}
+
+//
+// pickReplicas
+// @Description: 按优先级返回key的副本节点，本节点对应的元素为nil。PeerPicker不支持多副本时只返回归属节点
+// @receiver g
+// @param key
+// @return []PeerGetter
+//
+func (g *Group) pickReplicas(key string) []PeerGetter {
+	if rp, ok := g.peers.(ReplicaPicker); ok {
+		if replicas := rp.PickReplicas(key); len(replicas) > 0 {
+			return replicas
+		}
+		return []PeerGetter{nil}
+	}
+	if peer, ok := g.pickPeer(key); ok {
+		return []PeerGetter{peer}
+	}
+	return []PeerGetter{nil}
+}
+
+//
+// hasLocal
+// @Description: 本节点是否在副本节点之中
+// @param replicas
+// @return bool
+//
+func hasLocal(replicas []PeerGetter) bool {
+	for _, peer := range replicas {
+		if peer == nil {
+			return true
+		}
+	}
+	return false
+}
+
+//
+// replicate
+// @Description: 本节点作为副本本地加载后，异步写入排在本节点之后的副本节点，排在之前的节点刚刚查询失败，无需写入。
+// 写入失败时由副本节点在下次查询时自行加载
+// @receiver g
+// @param key
+// @param value
+// @param replicas
+//
+func (g *Group) replicate(key string, value ByteView, replicas []PeerGetter) {
+	req := &pb.SetRequest{
+		Group:  g.name,
+		Key:    key,
+		Value:  value.b,
+		Expire: toUnixNano(value.e),
+	}
+	local := false
+	for _, peer := range replicas {
+		if peer == nil {
+			local = true
+			continue
+		}
+		if !local {
+			continue
+		}
+		go func(peer PeerGetter) {
+			if err := peer.Set(context.Background(), req, &pb.Response{}); err != nil {
+				g.logKey(LevelWarn, "failed to replicate to peer", key, Field{"peer", peer}, Field{"err", err})
+			}
+		}(peer)
+	}
 }
@@ -1,10 +1,27 @@
 package gocache
 
 import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	pb "gocache/gocachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"io"
 	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 //
@@ -17,7 +34,7 @@ func TestGetter(t *testing.T) {
 		return []byte(key), nil
 	})
 	expect := []byte("key")
-	if v, _ := f.Get("key"); !reflect.DeepEqual(v, expect) {
+	if v, _ := f.Get(context.Background(), "key"); !reflect.DeepEqual(v, expect) {
 		t.Errorf("callback error")
 	}
 }
@@ -58,3 +75,1207 @@ func TestGet(t *testing.T) {
 		t.Fatalf("%s should be empty", view)
 	}
 }
+
+func TestSetRemove(t *testing.T) {
+	loads := 0
+	g := NewGroup("set-remove", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads++
+			return []byte("db-" + key), nil
+		}))
+	if err := g.Set("Tom", []byte("630")); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := g.Get("Tom"); err != nil || view.String() != "630" || loads != 0 {
+		t.Fatalf("expected value set explicitly, got %v %v", view, err)
+	}
+	if err := g.Remove("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if view, err := g.Get("Tom"); err != nil || view.String() != "db-Tom" || loads != 1 {
+		t.Fatalf("expected value reloaded after remove, got %v %v", view, err)
+	}
+	if err := g.Invalidate("Tom"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("Tom"); ok {
+		t.Fatalf("Tom should be invalidated")
+	}
+}
+
+func TestHTTPSetRemove(t *testing.T) {
+	g := NewGroup("http-set-remove", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	pool := NewHTTPPool("self")
+	server := httptest.NewServer(pool)
+	defer server.Close()
+
+	peer := &httpGetter{baseURL: server.URL + defaultBasePath}
+	err := peer.Set(context.Background(), &pb.SetRequest{Group: g.name, Key: "k/1", Value: []byte("v1")}, &pb.Response{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.mainCache.get("k/1"); !ok || v.String() != "v1" {
+		t.Fatalf("remote set failed, got %v", v)
+	}
+	if err = peer.Remove(context.Background(), &pb.Request{Group: g.name, Key: "k/1"}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("k/1"); ok {
+		t.Fatalf("remote remove failed")
+	}
+}
+
+func TestExpiration(t *testing.T) {
+	loads := 0
+	g := NewGroup("expiration", 2<<10, TTLGetterFunc(
+		func(_ context.Context, key string) ([]byte, time.Duration, error) {
+			loads++
+			if key == "short" {
+				return []byte(key), time.Millisecond, nil
+			}
+			return []byte(key), 0, nil
+		}), WithExpiration(time.Hour), WithSweepInterval(5*time.Millisecond))
+
+	view, err := g.Get("long")
+	if err != nil || view.Expire().IsZero() || time.Until(view.Expire()) < 50*time.Minute {
+		t.Fatalf("expected group default expiration, got %v", view.Expire())
+	}
+	if _, err = g.Get("short"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	//后台清理应已回收过期的缓存
+	if n := g.mainCache.stats().Items; n != 1 {
+		t.Fatalf("expected expired entry swept, %d entries left", n)
+	}
+	if _, err = g.Get("short"); err != nil || loads != 3 {
+		t.Fatalf("expected expired key reloaded, loads %d", loads)
+	}
+}
+
+func TestGetContext(t *testing.T) {
+	canceled := make(chan error, 1)
+	g := NewGroup("context", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			<-ctx.Done()
+			canceled <- ctx.Err()
+			return nil, ctx.Err()
+		}))
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := g.GetContext(ctx, "slow"); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+	//调用方的截止时间传递至回调函数
+	select {
+	case err := <-canceled:
+		if !errors.Is(err, context.DeadlineExceeded) || time.Since(start) > 80*time.Millisecond {
+			t.Fatalf("getter should observe the caller's deadline, got %v after %v", err, time.Since(start))
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("getter did not observe the caller's deadline")
+	}
+
+	//截止时间经由http请求传递至远程节点的回调函数
+	server := httptest.NewServer(NewHTTPPool("self"))
+	defer server.Close()
+	peer := &httpGetter{baseURL: server.URL + defaultBasePath}
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if err := peer.Get(ctx, &pb.Request{Group: g.name, Key: "remote"}, &pb.Response{}); err == nil {
+		t.Fatalf("expected remote call to fail at the deadline")
+	}
+	if elapsed := time.Since(start); elapsed > 80*time.Millisecond {
+		t.Fatalf("remote call should return at its deadline, waited %v", elapsed)
+	}
+	select {
+	case <-canceled:
+	case <-time.After(80 * time.Millisecond):
+		t.Fatalf("remote getter did not observe the caller's deadline")
+	}
+
+	//调用方的截止时间同样传递给远程节点的请求
+	peerDeadline := make(chan time.Time, 1)
+	local := NewGroup("context-peer", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}))
+	local.RegisterPeers(fakeReplicas{deadlinePeer{deadlines: peerDeadline}})
+	ctx, cancel = context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	local.GetContext(ctx, "remote")
+	if want, _ := ctx.Deadline(); !(<-peerDeadline).Equal(want) {
+		t.Fatalf("expected the peer request to carry the caller's deadline")
+	}
+}
+
+//
+// deadlinePeer
+// @Description: 记录请求ctx截止时间的远程节点
+//
+type deadlinePeer struct {
+	PeerGetter
+	deadlines chan time.Time
+}
+
+func (p deadlinePeer) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	deadline, _ := ctx.Deadline()
+	p.deadlines <- deadline
+	out.Value = []byte("peer-" + in.Key)
+	return nil
+}
+
+func TestLoadSurvivesCallerCancel(t *testing.T) {
+	started := make(chan struct{})
+	release := make(chan struct{})
+	g := NewGroup("context-shared", 2<<10, ContextGetterFunc(
+		func(ctx context.Context, key string) ([]byte, error) {
+			close(started)
+			select {
+			case <-release:
+				return []byte("db-" + key), nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}))
+	ctxA, cancelA := context.WithCancel(context.Background())
+	errA := make(chan error, 1)
+	go func() {
+		_, err := g.GetContext(ctxA, "k")
+		errA <- err
+	}()
+	<-started
+	type result struct {
+		view ByteView
+		err  error
+	}
+	resB := make(chan result, 1)
+	go func() {
+		view, err := g.GetContext(context.Background(), "k")
+		resB <- result{view, err}
+	}()
+	//A放弃等待不影响共享的加载
+	cancelA()
+	if err := <-errA; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected caller A to be canceled, got %v", err)
+	}
+	close(release)
+	res := <-resB
+	if res.err != nil || res.view.String() != "db-k" {
+		t.Fatalf("expected caller B to get the value, got %q %v", res.view.String(), res.err)
+	}
+}
+
+func TestGRPCPool(t *testing.T) {
+	g := NewGroup("grpc", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}), WithExpiration(time.Hour))
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := grpc.NewServer()
+	NewGRPCPool(lis.Addr().String()).Register(server)
+	go server.Serve(lis)
+	defer server.Stop()
+
+	pool := NewGRPCPool("self")
+	defer pool.Close()
+	if err = pool.Set("self", lis.Addr().String()); err != nil {
+		t.Fatal(err)
+	}
+	peer, ok := pool.PickPeer("Sally")
+	if !ok {
+		t.Fatalf("expected remote peer for single remote node")
+	}
+	ctx := context.Background()
+	res := &pb.Response{}
+	if err = peer.Get(ctx, &pb.Request{Group: g.name, Key: "Sally"}, res); err != nil || string(res.Value) != "110" || res.Expire == 0 {
+		t.Fatalf("remote get failed: %v %v", res, err)
+	}
+	if err = peer.Get(ctx, &pb.Request{Group: g.name, Key: "unknown"}, &pb.Response{}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound for unknown key, got %v", err)
+	}
+	//未提供的Group返回Unavailable，与HTTP一致
+	if err = peer.Get(ctx, &pb.Request{Group: "unknown-group", Key: "Sally"}, &pb.Response{}); status.Code(err) != codes.Unavailable {
+		t.Fatalf("expected Unavailable for unknown group, got %v", err)
+	}
+	if err = peer.Set(ctx, &pb.SetRequest{Group: g.name, Key: "k", Value: []byte("v")}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.mainCache.get("k"); !ok || v.String() != "v" {
+		t.Fatalf("remote set failed, got %v", v)
+	}
+	if err = peer.Remove(ctx, &pb.Request{Group: g.name, Key: "k"}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.mainCache.get("k"); ok {
+		t.Fatalf("remote remove failed")
+	}
+}
+
+//
+// fakePeer
+// @Description: 测试用的内存节点，记录收到的批量请求次数与写入的key
+//
+type fakePeer struct {
+	PeerGetter
+	batches int
+	fail    bool
+	mu      sync.Mutex
+	sets    []string
+}
+
+func (p *fakePeer) Set(_ context.Context, in *pb.SetRequest, _ *pb.Response) error {
+	if p.fail {
+		return fmt.Errorf("peer down")
+	}
+	p.mu.Lock()
+	p.sets = append(p.sets, in.Key+"="+string(in.Value))
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *fakePeer) setKeys() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]string(nil), p.sets...)
+}
+
+func (p *fakePeer) GetMany(_ context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	p.batches++
+	if p.fail {
+		return fmt.Errorf("peer down")
+	}
+	for _, key := range in.Keys {
+		if key == "remote-missing" {
+			out.Responses = append(out.Responses, &pb.Response{Error: key + " not exist", Code: pb.Code_NOT_FOUND})
+			continue
+		}
+		if key == "remote-unavailable" {
+			out.Responses = append(out.Responses, &pb.Response{Error: key + " unavailable", Code: pb.Code_UNAVAILABLE})
+			continue
+		}
+		out.Responses = append(out.Responses, &pb.Response{Value: []byte("peer-" + key)})
+	}
+	return nil
+}
+
+type fakePicker map[string]*fakePeer
+
+func (p fakePicker) PickPeer(key string) (PeerGetter, bool) {
+	for prefix, peer := range p {
+		if strings.HasPrefix(key, prefix) {
+			return peer, true
+		}
+	}
+	return nil, false
+}
+
+func TestGetMany(t *testing.T) {
+	batches := 0
+	g := NewGroup("get-many", 2<<10, BatchGetterFunc(
+		func(_ context.Context, keys []string) (map[string][]byte, error) {
+			batches++
+			values := make(map[string][]byte)
+			for _, key := range keys {
+				if key != "local-missing" {
+					values[key] = []byte("db-" + key)
+				}
+			}
+			return values, nil
+		}))
+	remote, broken := &fakePeer{}, &fakePeer{fail: true}
+	g.RegisterPeers(fakePicker{"remote": remote, "broken": broken})
+	g.Set("cached", []byte("v"))
+
+	keys := []string{"cached", "local-1", "remote-1", "local-2", "remote-2", "remote-missing", "local-missing", "broken-1", "remote-1", "remote-unavailable", ""}
+	values, errs := g.GetMany(keys)
+	expect := []string{"v", "db-local-1", "peer-remote-1", "db-local-2", "peer-remote-2", "", "", "db-broken-1", "peer-remote-1", "db-remote-unavailable", ""}
+	for i, key := range keys {
+		wantErr := key == "remote-missing" || key == "local-missing" || key == ""
+		if (errs[i] != nil) != wantErr || values[i].String() != expect[i] {
+			t.Errorf("key %q: got %q %v, want %q", key, values[i].String(), errs[i], expect[i])
+		}
+	}
+	if remote.batches != 1 || broken.batches != 1 {
+		t.Fatalf("expected one batch per peer, got %d %d", remote.batches, broken.batches)
+	}
+	//本地未命中与远程失败、远程返回可重试错误的key合并为一次批量回调
+	if batches != 1 {
+		t.Fatalf("expected one local batch load, got %d", batches)
+	}
+
+	server := httptest.NewServer(NewHTTPPool("self"))
+	defer server.Close()
+	peer := &httpGetter{baseURL: server.URL + defaultBasePath}
+	res := &pb.BatchResponse{}
+	err := peer.GetMany(context.Background(), &pb.BatchRequest{Group: g.name, Keys: []string{"local-1", "local-missing"}}, res)
+	if err != nil || len(res.Responses) != 2 {
+		t.Fatalf("remote batch failed: %v %v", res, err)
+	}
+	if string(res.Responses[0].Value) != "db-local-1" || res.Responses[1].Error == "" {
+		t.Fatalf("unexpected batch responses %v", res.Responses)
+	}
+}
+
+func TestGetManySharesLoads(t *testing.T) {
+	var mu sync.Mutex
+	loads := make(map[string]int)
+	started, release := make(chan struct{}), make(chan struct{})
+	g := NewGroup("get-many-shared", 2<<10, BatchGetterFunc(
+		func(_ context.Context, keys []string) (map[string][]byte, error) {
+			mu.Lock()
+			for _, key := range keys {
+				loads[key]++
+			}
+			mu.Unlock()
+			if keys[0] == "slow" {
+				close(started)
+				<-release
+			}
+			values := make(map[string][]byte)
+			for _, key := range keys {
+				values[key] = []byte("db-" + key)
+			}
+			return values, nil
+		}))
+	res := make(chan ByteView, 1)
+	go func() {
+		v, _ := g.Get("slow")
+		res <- v
+	}()
+	<-started
+	//slow的加载进行中，批量获取等待该次加载而不再次回调
+	done := make(chan struct{})
+	var (
+		values []ByteView
+		errs   []error
+	)
+	go func() {
+		values, errs = g.GetMany([]string{"slow", "other"})
+		close(done)
+	}()
+	for {
+		mu.Lock()
+		n := loads["other"]
+		mu.Unlock()
+		if n == 1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	<-done
+	if errs[0] != nil || errs[1] != nil || values[0].String() != "db-slow" || values[1].String() != "db-other" {
+		t.Fatalf("unexpected results %v %v", values, errs)
+	}
+	if v := <-res; v.String() != "db-slow" {
+		t.Fatalf("unexpected value %q", v.String())
+	}
+	if loads["slow"] != 1 || loads["other"] != 1 {
+		t.Fatalf("expected each key to be loaded once, got %v", loads)
+	}
+}
+
+func TestHTTPPoolMembership(t *testing.T) {
+	pool := NewHTTPPool("http://a", WithAdminPath("/_admin/"), WithAdminToken("secret"))
+	pool.Set("http://a", "http://b")
+
+	//未携带、携带错误令牌或未使用Bearer前缀的请求被拒绝
+	for _, auth := range []string{"", "Bearer wrong", "secret", "Basic secret"} {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(http.MethodPost, "/_admin/peers?peer=http://evil", nil)
+		if auth != "" {
+			r.Header.Set("Authorization", auth)
+		}
+		pool.ServeHTTP(w, r)
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("expected unauthorized with %q, got %d", auth, w.Code)
+		}
+	}
+	if peers := pool.Peers(); !reflect.DeepEqual(peers, []string{"http://a", "http://b"}) {
+		t.Fatalf("unauthorized request changed peers: %v", peers)
+	}
+
+	admin := func(method, query string) []string {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(method, "/_admin/peers"+query, nil)
+		r.Header.Set("Authorization", "Bearer secret")
+		pool.ServeHTTP(w, r)
+		if w.Code != http.StatusOK {
+			t.Fatalf("%s %s returned %d", method, query, w.Code)
+		}
+		var peers []string
+		if err := json.Unmarshal(w.Body.Bytes(), &peers); err != nil {
+			t.Fatal(err)
+		}
+		return peers
+	}
+	if peers := admin(http.MethodPost, "?peer=http://c&peer=http://b"); !reflect.DeepEqual(peers, []string{"http://a", "http://b", "http://c"}) {
+		t.Fatalf("unexpected peers after join: %v", peers)
+	}
+	if peers := admin(http.MethodDelete, "?peer=http://b"); !reflect.DeepEqual(peers, []string{"http://a", "http://c"}) {
+		t.Fatalf("unexpected peers after drain: %v", peers)
+	}
+	picked := make(map[string]int)
+	for i := 0; i < 1000; i++ {
+		if peer, ok := pool.PickPeer(strconv.Itoa(i)); ok {
+			picked[peer.(*httpGetter).baseURL]++
+		}
+	}
+	if len(picked) != 1 || picked["http://c"+defaultBasePath] == 0 {
+		t.Fatalf("expected only http://c to be picked, got %v", picked)
+	}
+}
+
+func TestHTTPPoolWeights(t *testing.T) {
+	pool := NewHTTPPool("http://self", WithAdminPath("/_admin/"), WithAdminToken("secret"))
+	pool.SetWeighted(map[string]int{"http://a": 1, "http://b": 3})
+
+	count := func() map[string]int {
+		picked := make(map[string]int)
+		for i := 0; i < 10000; i++ {
+			if peer, ok := pool.PickPeer(strconv.Itoa(i)); ok {
+				picked[strings.TrimSuffix(peer.(*httpGetter).baseURL, defaultBasePath)]++
+			}
+		}
+		return picked
+	}
+	picked := count()
+	if ratio := float64(picked["http://b"]) / float64(picked["http://a"]); ratio < 2 || ratio > 4.5 {
+		t.Fatalf("expected http://b to own about 3x the keys of http://a, got %v", picked)
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPut, "/_admin/peers?peer=http://a&weight=3", nil)
+	r.Header.Set("Authorization", "Bearer secret")
+	pool.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Fatalf("set weight returned %d", w.Code)
+	}
+	if weights := pool.Weights(); !reflect.DeepEqual(weights, map[string]int{"http://a": 3, "http://b": 3}) {
+		t.Fatalf("unexpected weights %v", weights)
+	}
+	picked = count()
+	if ratio := float64(picked["http://b"]) / float64(picked["http://a"]); ratio < 0.6 || ratio > 1.6 {
+		t.Fatalf("expected equal weights to split keys evenly, got %v", picked)
+	}
+
+	pool.SetWeight("http://a", 0)
+	if peers := pool.Peers(); !reflect.DeepEqual(peers, []string{"http://b"}) {
+		t.Fatalf("expected weight 0 to remove the peer, got %v", peers)
+	}
+}
+
+func TestHTTPPoolBoundedLoad(t *testing.T) {
+	pool := NewHTTPPool("http://self", WithBoundedLoad(1.25))
+	pool.Set("http://self", "http://a", "http://b")
+	key := ""
+	for i := 0; key == ""; i++ {
+		if pool.peers.Get(strconv.Itoa(i)) == "http://a" {
+			key = strconv.Itoa(i)
+		}
+	}
+	picked := func() string {
+		peer, ok := pool.PickPeer(key)
+		if !ok {
+			return "http://self"
+		}
+		return strings.TrimSuffix(peer.(*httpGetter).baseURL, defaultBasePath)
+	}
+	if peer := picked(); peer != "http://a" {
+		t.Fatalf("expected owner http://a without load, got %s", peer)
+	}
+	//http://a上进行中的请求超出容量时顺延至下一个节点
+	pool.httpGetters["http://a"].stats.inflight.Add(10)
+	if peer := picked(); peer == "http://a" {
+		t.Fatalf("expected overloaded http://a to be skipped")
+	}
+	pool.httpGetters["http://a"].stats.inflight.Add(-10)
+	if peer := picked(); peer != "http://a" {
+		t.Fatalf("expected http://a to be picked again after load drops, got %s", peer)
+	}
+	//副本查询不按负载顺延，两者同时开启时拒绝；容量系数小于1或副本数小于1时拒绝
+	for _, opts := range [][]HTTPPoolOption{
+		{WithBoundedLoad(1.25), WithReplication(2)},
+		{WithBoundedLoad(0.5)},
+		{WithReplication(0)},
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected invalid options to panic")
+				}
+			}()
+			NewHTTPPool("http://self", opts...)
+		}()
+	}
+}
+
+func TestHTTPPoolBoundedLoadOverflow(t *testing.T) {
+	var loads sync.Map
+	release := make(chan struct{})
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		n, _ := loads.LoadOrStore(key, new(AtomicInt))
+		n.(*AtomicInt).Add(1)
+		if strings.HasPrefix(key, "block") {
+			<-release
+		}
+		return []byte("db-" + key), nil
+	})
+	//归属节点与顺延节点各自运行HTTPPool与Group，客户端节点不在哈希环上
+	type node struct {
+		server *httptest.Server
+		pool   *HTTPPool
+	}
+	newNode := func() *node {
+		n := &node{}
+		n.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n.pool.ServeHTTP(w, r)
+		}))
+		n.pool = NewHTTPPool(n.server.URL, WithBoundedLoad(1.25))
+		g := NewGroup("bounded-overflow", 2<<10, getter)
+		g.RegisterPeers(n.pool)
+		n.pool.getGroup = func(string) *Group { return g }
+		return n
+	}
+	owner, next := newNode(), newNode()
+	defer owner.server.Close()
+	defer next.server.Close()
+	client := NewHTTPPool("http://client", WithBoundedLoad(1.25))
+	g := NewGroup("bounded-overflow", 2<<10, getter)
+	g.RegisterPeers(client)
+	for _, p := range []*HTTPPool{owner.pool, next.pool, client} {
+		p.Set(owner.server.URL, next.server.URL)
+	}
+
+	owned := func(prefix string, n int) []string {
+		var keys []string
+		for i := 0; len(keys) < n; i++ {
+			if key := prefix + strconv.Itoa(i); client.peers.Get(key) == owner.server.URL {
+				keys = append(keys, key)
+			}
+		}
+		return keys
+	}
+	//归属节点上保持两个进行中的请求，使其超出容量
+	var wg sync.WaitGroup
+	for _, key := range owned("block", 2) {
+		wg.Add(1)
+		go func(key string) {
+			defer wg.Done()
+			g.Get(key)
+		}(key)
+	}
+	for client.httpGetters[owner.server.URL].stats.inflight.Get() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	key := owned("k", 1)[0]
+	view, err := g.Get(key)
+	if err != nil || view.String() != "db-"+key {
+		t.Fatalf("unexpected value %q %v", view.String(), err)
+	}
+	if stats := client.PeerStats(); stats[next.server.URL].Requests != 1 || stats[owner.server.URL].InFlight != 2 {
+		t.Fatalf("expected the key to overflow to the next node, got %+v", stats)
+	}
+	//顺延节点直接本地加载，不再把请求送回归属节点
+	if stats := next.pool.PeerStats(); stats[owner.server.URL].Requests != 0 {
+		t.Fatalf("expected the next node to serve locally, got %+v", stats)
+	}
+	if n, _ := loads.Load(key); n.(*AtomicInt).Get() != 1 {
+		t.Fatalf("expected a single load, got %d", n.(*AtomicInt).Get())
+	}
+	close(release)
+	wg.Wait()
+}
+
+func (p *fakePeer) Get(_ context.Context, in *pb.Request, out *pb.Response) error {
+	if p.fail {
+		return fmt.Errorf("peer down")
+	}
+	if strings.HasSuffix(in.Key, "missing") {
+		out.Error, out.Code = in.Key+" not exist", pb.Code_NOT_FOUND
+		return nil
+	}
+	out.Value = []byte("peer-" + in.Key)
+	return nil
+}
+
+func TestHotCache(t *testing.T) {
+	g := NewGroup("hot", 1000, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithHotCache(0.25))
+	if g.mainCache.cacheBytes != 750 || g.hotCache.cacheBytes != 250 {
+		t.Fatalf("unexpected budget split %d/%d", g.mainCache.cacheBytes, g.hotCache.cacheBytes)
+	}
+	peer := &fakePeer{}
+	for i := 0; i < 200; i++ {
+		if _, err := g.getFromPeer(context.Background(), peer, "remote-hot"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	//抽样概率为1/10，200次远程获取后几乎必然已进入热点缓存
+	if v, ok := g.lookupCache("remote-hot"); !ok || v.String() != "peer-remote-hot" {
+		t.Fatalf("expected remote-hot in hot cache")
+	}
+	if stats := g.CacheStats(HotCache); stats.Items != 1 || stats.Hits != 1 {
+		t.Fatalf("unexpected hot cache stats %+v", stats)
+	}
+	if err := g.Invalidate("remote-hot"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := g.lookupCache("remote-hot"); ok {
+		t.Fatalf("invalidate should drop hot copy")
+	}
+
+	//容量很小时两者仍各有上限，不会因划分为0而变为不限制
+	getter := GetterFunc(func(key string) ([]byte, error) { return []byte(key), nil })
+	for _, ratio := range []float64{0.01, 0.99} {
+		g = NewGroup("hot-small", 2, getter, WithHotCache(ratio))
+		if g.mainCache.cacheBytes != 1 || g.hotCache.cacheBytes != 1 {
+			t.Fatalf("ratio %v: unexpected budget split %d/%d", ratio, g.mainCache.cacheBytes, g.hotCache.cacheBytes)
+		}
+	}
+	for _, ratio := range []float64{-0.5, 1, 2} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected ratio %v to be rejected", ratio)
+				}
+			}()
+			NewGroup("hot-invalid", 1000, getter, WithHotCache(ratio))
+		}()
+	}
+}
+
+func TestGroupClose(t *testing.T) {
+	g := NewGroup("close", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte(key), nil
+		}), WithExpiration(time.Minute))
+	g.Get("k")
+	g.Close()
+	if GetGroup("close") != nil {
+		t.Fatalf("expected closed group to be unregistered")
+	}
+	select {
+	case <-g.mainCache.done:
+	default:
+		t.Fatalf("expected sweeper of the main cache to be stopped")
+	}
+}
+
+func TestStats(t *testing.T) {
+	g := NewGroup("stats", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	g.Get("Sally")
+	g.Get("Sally")
+	g.Get("unknown")
+	stats := g.Stats()
+	if stats.Gets != 3 || stats.CacheHits != 1 || stats.Loads != 2 || stats.LoadsDeduped != 2 ||
+		stats.LocalLoads != 1 || stats.LocalLoadErrs != 1 || stats.MainCache.Items != 1 {
+		t.Fatalf("unexpected group stats %+v", stats)
+	}
+
+	server := httptest.NewServer(NewHTTPPool("self"))
+	defer server.Close()
+	pool := NewHTTPPool("self")
+	pool.Set("self", server.URL, "http://127.0.0.1:1")
+	ctx := context.Background()
+	if err := pool.httpGetters[server.URL].Get(ctx, &pb.Request{Group: g.name, Key: "Sally"}, &pb.Response{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := pool.httpGetters["http://127.0.0.1:1"].Get(ctx, &pb.Request{Group: g.name, Key: "Sally"}, &pb.Response{}); err == nil {
+		t.Fatalf("expected error from unreachable peer")
+	}
+	if n := g.Stats().ServerRequests; n != 1 {
+		t.Fatalf("expected 1 server request, got %d", n)
+	}
+	peerStats := pool.PeerStats()
+	if s := peerStats[server.URL]; s.Requests != 1 || s.Errors != 0 || s.AvgLatency <= 0 {
+		t.Fatalf("unexpected peer stats %+v", s)
+	}
+	if s := peerStats["http://127.0.0.1:1"]; s.Requests != 1 || s.Errors != 1 {
+		t.Fatalf("unexpected peer stats %+v", s)
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	g := NewGroup("metrics", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist", key)
+		}))
+	g.Get("Link")
+	g.Get("Link")
+
+	pool := NewHTTPPool("self", WithMetricsPath("/_gocache_metrics"))
+	pool.Set("self", "http://127.0.0.1:1", "http://127.0.0.1:2")
+	pool.httpGetters["http://127.0.0.1:1"].Get(context.Background(), &pb.Request{Group: g.name, Key: "Link"}, &pb.Response{})
+	server := httptest.NewServer(pool)
+	defer server.Close()
+	res, err := http.Get(server.URL + "/_gocache_metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	var body strings.Builder
+	if _, err := io.Copy(&body, res.Body); err != nil {
+		t.Fatal(err)
+	}
+	out := body.String()
+	for _, line := range []string{
+		"# TYPE gocache_gets_total counter",
+		`gocache_gets_total{group="metrics"} 2`,
+		`gocache_cache_hits_total{group="metrics"} 1`,
+		`gocache_cache_items{group="metrics",cache="main"} 1`,
+		"# TYPE gocache_load_duration_seconds histogram",
+		`gocache_load_duration_seconds_bucket{group="metrics",le="+Inf"} 1`,
+		`gocache_load_duration_seconds_count{group="metrics"} 1`,
+		`gocache_peer_requests_total{peer="http://127.0.0.1:1"} 1`,
+		`gocache_peer_request_errors_total{peer="http://127.0.0.1:1"} 1`,
+		`gocache_peer_request_duration_seconds_count{peer="http://127.0.0.1:1"} 1`,
+	} {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("metrics output missing %q", line)
+		}
+	}
+	if strings.Count(out, "# TYPE gocache_gets_total ") != 1 {
+		t.Errorf("metric metadata should be written once")
+	}
+	checkMetricFamilies(t, out)
+}
+
+func TestMetricsHistogram(t *testing.T) {
+	h := &histogram{}
+	done := make(chan struct{})
+	for j := 0; j < 4; j++ {
+		go func() {
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				//覆盖各个桶以及超出最大桶的耗时
+				h.observe(time.Duration(i%20) * time.Second / 8)
+			}
+		}()
+	}
+	defer close(done)
+	for n := 0; n < 2000; n++ {
+		var buf bytes.Buffer
+		m := &metricsWriter{w: bufio.NewWriter(&buf)}
+		m.histogram("latency", `group="g"`, h)
+		m.w.Flush()
+		var last, inf, count int64 = 0, -1, -2
+		for _, line := range strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n") {
+			v, err := strconv.ParseInt(line[strings.LastIndexByte(line, ' ')+1:], 10, 64)
+			switch {
+			case strings.HasPrefix(line, "latency_sum"):
+				continue
+			case err != nil:
+				t.Fatalf("malformed sample %q", line)
+			case strings.HasPrefix(line, "latency_count"):
+				count = v
+			case strings.Contains(line, `le="+Inf"`):
+				inf = v
+				fallthrough
+			default:
+				if v < last {
+					t.Fatalf("bucket %q is below the previous bucket %d", line, last)
+				}
+				last = v
+			}
+		}
+		if inf != count {
+			t.Fatalf("expected +Inf bucket %d to equal count %d", inf, count)
+		}
+	}
+}
+
+//
+// checkMetricFamilies
+// @Description: 按Prometheus文本格式解析输出，每个指标的HELP与TYPE只出现一次且位于样本之前，同名指标的样本连续排列
+// @param t
+// @param out
+//
+func checkMetricFamilies(t *testing.T, out string) {
+	t.Helper()
+	seen := make(map[string]bool)
+	var family, typ string
+	for _, line := range strings.Split(strings.TrimSuffix(out, "\n"), "\n") {
+		if strings.HasPrefix(line, "# HELP ") {
+			continue
+		}
+		if strings.HasPrefix(line, "# TYPE ") {
+			fields := strings.Fields(line)
+			if len(fields) != 4 || seen[fields[2]] {
+				t.Fatalf("duplicate or malformed metadata %q", line)
+			}
+			family, typ = fields[2], fields[3]
+			seen[family] = true
+			continue
+		}
+		i, j := strings.IndexByte(line, '{'), strings.LastIndexByte(line, ' ')
+		if i < 0 || j < i || line[j-1] != '}' {
+			t.Fatalf("malformed sample %q", line)
+		}
+		if _, err := strconv.ParseFloat(line[j+1:], 64); err != nil {
+			t.Fatalf("malformed value in %q: %v", line, err)
+		}
+		name := line[:i]
+		if typ == "histogram" {
+			for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+				if strings.HasSuffix(name, suffix) {
+					name = strings.TrimSuffix(name, suffix)
+					break
+				}
+			}
+		}
+		if name != family {
+			t.Fatalf("sample %q is not contiguous with its family %s", line, name)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	g := NewGroup("errors", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			switch key {
+			case "boom":
+				return nil, fmt.Errorf("db down")
+			case "Sally":
+				return []byte(db[key]), nil
+			}
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}))
+	server := httptest.NewServer(NewHTTPPool("self"))
+	defer server.Close()
+	pool := NewHTTPPool("self")
+	pool.Set("self", server.URL)
+	peer := pool.httpGetters[server.URL]
+	ctx := context.Background()
+	res := &pb.Response{}
+	if err := peer.Get(ctx, &pb.Request{Group: g.name, Key: "Sally"}, res); err != nil || string(res.Value) != "110" {
+		t.Fatalf("remote get failed: %v %v", res, err)
+	}
+	if err := peer.Get(ctx, &pb.Request{Group: g.name, Key: "unknown"}, &pb.Response{}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := peer.Get(ctx, &pb.Request{Group: g.name, Key: "boom"}, &pb.Response{}); err == nil || errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected internal error, got %v", err)
+	}
+	//未提供该Group时返回UNAVAILABLE，不能当作key不存在
+	err := peer.Get(ctx, &pb.Request{Group: "no-such-group", Key: "k"}, &pb.Response{})
+	var remote *remoteError
+	if !errors.As(err, &remote) || remote.code != pb.Code_UNAVAILABLE {
+		t.Fatalf("expected unavailable error for unknown group, got %v", err)
+	}
+	if s := pool.PeerStats()[server.URL]; s.Requests != 4 || s.Errors != 2 {
+		t.Fatalf("not found should not count as peer error, got %+v", s)
+	}
+
+	//归属节点确认不存在时不回源，节点故障时退化为本地加载
+	var loads []string
+	local := NewGroup("errors-fallback", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads = append(loads, key)
+			return []byte("db-" + key), nil
+		}))
+	local.RegisterPeers(fakePicker{"remote": &fakePeer{}, "broken": &fakePeer{fail: true}})
+	if v, err := local.Get("remote-1"); err != nil || v.String() != "peer-remote-1" {
+		t.Fatalf("expected value from peer, got %q %v", v.String(), err)
+	}
+	if _, err := local.Get("remote-missing"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("expected ErrNotFound from owner, got %v", err)
+	}
+	if v, err := local.Get("broken-1"); err != nil || v.String() != "db-broken-1" {
+		t.Fatalf("expected local fallback, got %q %v", v.String(), err)
+	}
+	if !reflect.DeepEqual(loads, []string{"broken-1"}) {
+		t.Fatalf("unexpected local loads %v", loads)
+	}
+}
+
+func TestNegativeCache(t *testing.T) {
+	loads := make(map[string]int)
+	g := NewGroup("negative", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads[key]++
+			if v, ok := db[key]; ok {
+				return []byte(v), nil
+			}
+			return nil, fmt.Errorf("%s not exist: %w", key, ErrNotFound)
+		}), WithNegativeCache(50*time.Millisecond, 64))
+	for i := 0; i < 3; i++ {
+		if _, err := g.Get("unknown"); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("expected ErrNotFound, got %v", err)
+		}
+	}
+	if loads["unknown"] != 1 || g.Stats().NegativeHits != 2 {
+		t.Fatalf("negative cache miss, loads %d stats %+v", loads["unknown"], g.Stats())
+	}
+	time.Sleep(60 * time.Millisecond)
+	g.Get("unknown")
+	if loads["unknown"] != 2 {
+		t.Fatalf("negative entry should expire, loads %d", loads["unknown"])
+	}
+	//写入后负缓存失效
+	g.Set("unknown", []byte("v"))
+	if v, err := g.Get("unknown"); err != nil || v.String() != "v" {
+		t.Fatalf("expected value after set, got %q %v", v.String(), err)
+	}
+	//容量有界
+	for i := 0; i < 100; i++ {
+		g.Get("missing-" + strconv.Itoa(i))
+	}
+	if s := g.CacheStats(NegativeCache); s.Bytes > 64 || s.Items == 0 {
+		t.Fatalf("negative cache exceeds bound %+v", s)
+	}
+	//其他错误不进入负缓存
+	g.getter = GetterFunc(func(key string) ([]byte, error) {
+		loads[key]++
+		return nil, fmt.Errorf("db down")
+	})
+	g.Get("down")
+	g.Get("down")
+	if loads["down"] != 2 {
+		t.Fatalf("only not found should be cached, loads %d", loads["down"])
+	}
+
+	//归属节点返回的不存在同样被记住
+	remote := NewGroup("negative-remote", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, fmt.Errorf("local getter should not be called")
+		}), WithNegativeCache(time.Minute, 1<<10))
+	remote.RegisterPeers(fakePicker{"remote": &fakePeer{}})
+	remote.Get("remote-missing")
+	if _, err := remote.Get("remote-missing"); !errors.Is(err, ErrNotFound) || remote.Stats().NegativeHits != 1 {
+		t.Fatalf("expected negative hit for remote miss, got %v %+v", err, remote.Stats())
+	}
+
+	//未指定容量时使用默认上限，而非不限制
+	g = NewGroup("negative-default", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return nil, ErrNotFound
+		}), WithNegativeCache(time.Minute, 0))
+	if g.negativeCache.cacheBytes != defaultNegativeCacheBytes {
+		t.Fatalf("expected default negative cache budget, got %d", g.negativeCache.cacheBytes)
+	}
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var (
+		lock    sync.Mutex
+		version = make(map[string]int)
+		block   = make(chan struct{})
+	)
+	loaded := func(key string) int {
+		lock.Lock()
+		defer lock.Unlock()
+		return version[key]
+	}
+	load := func(key string) ([]byte, error) {
+		if strings.HasPrefix(key, "slow") && loaded(key) > 0 {
+			<-block
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		version[key]++
+		return []byte(key + "-" + strconv.Itoa(version[key])), nil
+	}
+	waitLoaded := func(key string, n int) {
+		deadline := time.Now().Add(time.Second)
+		for loaded(key) < n {
+			if time.Now().After(deadline) {
+				t.Fatalf("key %s was not refreshed", key)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	g := NewGroup("stale", 2<<10, GetterFunc(load), WithExpiration(30*time.Millisecond),
+		WithStaleWhileRevalidate(time.Minute), WithMaxRefreshes(1))
+	g.Get("k")
+	time.Sleep(40 * time.Millisecond)
+	//过期后立即返回旧值，后台刷新
+	if v, err := g.Get("k"); err != nil || v.String() != "k-1" {
+		t.Fatalf("expected stale value, got %q %v", v.String(), err)
+	}
+	waitLoaded("k", 2)
+	time.Sleep(5 * time.Millisecond)
+	if v, _ := g.Get("k"); v.String() != "k-2" {
+		t.Fatalf("expected refreshed value, got %q", v.String())
+	}
+
+	//同一个key只刷新一次，超出并发上限的刷新被放弃
+	g.Get("slow-1")
+	g.Get("slow-2")
+	time.Sleep(40 * time.Millisecond)
+	before := g.Stats().Refreshes
+	for i := 0; i < 10; i++ {
+		g.Get("slow-1")
+		g.Get("slow-2")
+	}
+	if n := g.Stats().Refreshes - before; n != 1 {
+		t.Fatalf("expected 1 background refresh, got %d", n)
+	}
+	close(block)
+
+	ahead := NewGroup("refresh-ahead", 2<<10, GetterFunc(load), WithExpiration(100*time.Millisecond),
+		WithRefreshAhead(0.5))
+	ahead.Get("a")
+	ahead.Get("a")
+	if loaded("a") != 1 {
+		t.Fatalf("fresh value should not be refreshed")
+	}
+	time.Sleep(60 * time.Millisecond)
+	if v, _ := ahead.Get("a"); v.String() != "a-1" {
+		t.Fatalf("expected cached value, got %q", v.String())
+	}
+	waitLoaded("a", 2)
+
+	for _, fraction := range []float64{-0.5, 1, 2} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("expected refresh ahead fraction %v to be rejected", fraction)
+				}
+			}()
+			NewGroup("refresh-ahead-invalid", 2<<10, GetterFunc(load), WithRefreshAhead(fraction))
+		}()
+	}
+}
+
+func TestEvictionPolicy(t *testing.T) {
+	for name, policy := range map[string]PolicyFunc{"lru": LRU, "lfu": LFU, "arc": ARC, "2q": TwoQ, "tinylfu": TinyLFU} {
+		g := NewGroup("policy-"+name, 64, GetterFunc(
+			func(key string) ([]byte, error) {
+				return []byte(key), nil
+			}), WithEvictionPolicy(policy))
+		for i := 0; i < 20; i++ {
+			key := "key" + strconv.Itoa(i)
+			if v, err := g.Get(key); err != nil || v.String() != key {
+				t.Fatalf("%s: get %s failed: %q %v", name, key, v.String(), err)
+			}
+		}
+		if s := g.CacheStats(MainCache); s.Bytes > 64 || s.Items == 0 || s.Evictions == 0 {
+			t.Fatalf("%s: unexpected cache stats %+v", name, s)
+		}
+	}
+}
+
+//
+// fakeReplicas
+// @Description: 测试用的ReplicaPicker，所有key的副本节点相同，nil表示本节点
+//
+type fakeReplicas []PeerGetter
+
+func (r fakeReplicas) PickPeer(string) (PeerGetter, bool) {
+	return r[0], r[0] != nil
+}
+
+func (r fakeReplicas) PickReplicas(string) []PeerGetter {
+	return r
+}
+
+func TestReplication(t *testing.T) {
+	newGroup := func(name string, replicas fakeReplicas) *Group {
+		g := NewGroup(name, 2<<10, GetterFunc(
+			func(key string) ([]byte, error) {
+				return []byte("db-" + key), nil
+			}))
+		g.RegisterPeers(replicas)
+		return g
+	}
+
+	//归属节点故障时由下一个副本节点提供
+	remote, broken := &fakePeer{}, &fakePeer{fail: true}
+	g := newGroup("replica-failover", fakeReplicas{broken, remote})
+	if v, err := g.Get("k"); err != nil || v.String() != "peer-k" {
+		t.Fatalf("expected value from replica, got %q %v", v.String(), err)
+	}
+	if _, ok := g.mainCache.get("k"); ok {
+		t.Fatalf("value of a key this node does not replicate should not be in main cache")
+	}
+	//批量获取同样由下一个副本节点提供
+	g = newGroup("replica-failover-many", fakeReplicas{broken, remote})
+	if values, errs := g.GetMany([]string{"a", "b"}); errs[0] != nil || errs[1] != nil ||
+		values[0].String() != "peer-a" || values[1].String() != "peer-b" {
+		t.Fatalf("expected values from replica, got %v %v", values, errs)
+	}
+
+	//本节点同为副本时保存到主缓存
+	g = newGroup("replica-secondary", fakeReplicas{remote, nil})
+	if v, err := g.Get("k"); err != nil || v.String() != "peer-k" {
+		t.Fatalf("expected value from primary, got %q %v", v.String(), err)
+	}
+	if v, ok := g.mainCache.get("k"); !ok || v.String() != "peer-k" {
+		t.Fatalf("expected replica to keep the value in main cache")
+	}
+
+	//轮到本节点时本地加载并写入其后的副本
+	before, after := &fakePeer{fail: true}, &fakePeer{}
+	g = newGroup("replica-local", fakeReplicas{before, nil, after})
+	if v, err := g.Get("k"); err != nil || v.String() != "db-k" {
+		t.Fatalf("expected local load, got %q %v", v.String(), err)
+	}
+	for deadline := time.Now().Add(time.Second); len(after.setKeys()) == 0; {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected value to be replicated")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if sets := after.setKeys(); !reflect.DeepEqual(sets, []string{"k=db-k"}) {
+		t.Fatalf("unexpected replicated values %v", sets)
+	}
+
+	//写入同步至全部副本
+	primary := &fakePeer{}
+	g = newGroup("replica-set", fakeReplicas{primary, nil, after})
+	if err := g.Set("s", []byte("v")); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := g.mainCache.get("s"); !ok || v.String() != "v" {
+		t.Fatalf("expected local replica to be written")
+	}
+	if !reflect.DeepEqual(primary.setKeys(), []string{"s=v"}) || len(after.setKeys()) != 2 {
+		t.Fatalf("expected all replicas to be written, got %v %v", primary.setKeys(), after.setKeys())
+	}
+}
+
+func TestHTTPPoolReplicas(t *testing.T) {
+	pool := NewHTTPPool("http://self", WithReplication(2))
+	pool.Set("http://self", "http://a", "http://b")
+	for i := 0; i < 100; i++ {
+		key := strconv.Itoa(i)
+		replicas := pool.PickReplicas(key)
+		if len(replicas) != 2 || replicas[0] == replicas[1] {
+			t.Fatalf("expected 2 distinct replicas for %s, got %v", key, replicas)
+		}
+		peer, ok := pool.PickPeer(key)
+		if ok && replicas[0] != peer || !ok && replicas[0] != nil {
+			t.Fatalf("expected first replica of %s to be its owner", key)
+		}
+	}
+}
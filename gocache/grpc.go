@@ -0,0 +1,395 @@
+package gocache
+
+import (
+	"context"
+	"fmt"
+	"gocache/consistenthash"
+	pb "gocache/gocachepb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+	"net"
+	"sync"
+)
+
+//
+// GRPCPool
+// @Description: 基于gRPC的节点池，与HTTPPool一样实现PeerPicker，节点间复用HTTP/2长连接
+//
+type GRPCPool struct {
+	//记录本机地址，形如host:port
+	self string
+	mu   sync.Mutex
+	//一致性哈希Map
+	peers *consistenthash.Map
+	//本地客户端获取远程节点数据map
+	grpcGetters map[string]*grpcGetter
+	//建立连接时的拨号选项
+	dialOpts []grpc.DialOption
+	//分级日志，默认不输出请求级别的日志
+	logger Logger
+}
+
+//
+// NewGRPCPool
+// @Description: 实例化gRPC节点池，未指定拨号选项时使用明文连接
+// @param self
+// @param opts
+// @return *GRPCPool
+//
+func NewGRPCPool(self string, opts ...grpc.DialOption) *GRPCPool {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithTransportCredentials(insecure.NewCredentials())}
+	}
+	return &GRPCPool{
+		self:        self,
+		grpcGetters: make(map[string]*grpcGetter),
+		dialOpts:    opts,
+		logger:      defaultLogger,
+	}
+}
+
+//
+// SetLogger
+// @Description: 设置日志，需在开始服务前调用
+// @receiver p
+// @param l
+//
+func (p *GRPCPool) SetLogger(l Logger) {
+	p.logger = l
+}
+
+//
+// Log
+// @Description: 以Info级别输出带节点地址的日志
+// @receiver p
+// @param format
+// @param v
+//
+func (p *GRPCPool) Log(format string, v ...interface{}) {
+	if p.logger.Enabled(LevelInfo) {
+		p.logger.Log(LevelInfo, fmt.Sprintf(format, v...), Field{"self", p.self})
+	}
+}
+
+//
+// Serve
+// @Description: 在lis上启动gRPC服务，处理其余节点的请求
+// @receiver p
+// @param lis
+// @param opts
+// @return error
+//
+func (p *GRPCPool) Serve(lis net.Listener, opts ...grpc.ServerOption) error {
+	server := grpc.NewServer(opts...)
+	p.Register(server)
+	return server.Serve(lis)
+}
+
+//
+// Register
+// @Description: 将GroupCache服务注册到已有的gRPC服务上
+// @receiver p
+// @param server
+//
+func (p *GRPCPool) Register(server *grpc.Server) {
+	pb.RegisterGroupCacheServer(server, &grpcServer{})
+}
+
+//
+// Set
+// @Description: 实例化一致性哈希算法并传入实例节点，仍存在的节点复用已有连接
+// @receiver p
+// @param peers
+// @return error
+//
+func (p *GRPCPool) Set(peers ...string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	getters := make(map[string]*grpcGetter, len(peers))
+	for _, peer := range peers {
+		if peer == p.self {
+			continue
+		}
+		if getter, ok := p.grpcGetters[peer]; ok {
+			getters[peer] = getter
+			continue
+		}
+		//Dial不会阻塞，连接在首次调用时建立并在之后复用
+		conn, err := grpc.Dial(peer, p.dialOpts...)
+		if err != nil {
+			for addr, getter := range getters {
+				if _, ok := p.grpcGetters[addr]; !ok {
+					getter.conn.Close()
+				}
+			}
+			return fmt.Errorf("dial peer %s: %v", peer, err)
+		}
+		getters[peer] = &grpcGetter{conn: conn, client: pb.NewGroupCacheClient(conn)}
+	}
+	//关闭已下线节点的连接
+	for addr, getter := range p.grpcGetters {
+		if _, ok := getters[addr]; !ok {
+			getter.conn.Close()
+		}
+	}
+	p.peers = consistenthash.New(defaultReplicas, nil)
+	p.peers.Add(peers...)
+	p.grpcGetters = getters
+	return nil
+}
+
+//
+// PickPeer
+// @Description: 哈希列表中调用实际节点
+// @receiver p
+// @param key
+// @return PeerGetter
+// @return bool
+//
+func (p *GRPCPool) PickPeer(key string) (PeerGetter, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	//调用不为空，且不为本身节点
+	if peer := p.peers.Get(key); peer != "" && peer != p.self {
+		if p.logger.Enabled(LevelDebug) {
+			p.logger.Log(LevelDebug, "pick peer", Field{"self", p.self}, Field{"peer", peer}, keyHashField(key))
+		}
+		return p.grpcGetters[peer], true
+	}
+	return nil, false
+}
+
+//
+// Close
+// @Description: 关闭所有到远程节点的连接
+// @receiver p
+// @return error
+//
+func (p *GRPCPool) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var err error
+	for addr, getter := range p.grpcGetters {
+		if e := getter.conn.Close(); e != nil && err == nil {
+			err = e
+		}
+		delete(p.grpcGetters, addr)
+	}
+	return err
+}
+
+//
+// PeerStats
+// @Description: 返回客户端视角下各远程节点的请求统计
+// @receiver p
+// @return map[string]PeerStats
+//
+func (p *GRPCPool) PeerStats() map[string]PeerStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make(map[string]PeerStats, len(p.grpcGetters))
+	for peer, getter := range p.grpcGetters {
+		stats[peer] = getter.stats.snapshot()
+	}
+	return stats
+}
+
+//
+// grpcServer
+// @Description: GroupCache服务的服务端实现，处理其余节点的请求
+//
+type grpcServer struct {
+	pb.UnimplementedGroupCacheServer
+}
+
+//
+// Get
+// @Description: 处理远程节点的缓存查询请求
+// @receiver s
+// @param ctx
+// @param in
+// @return *pb.Response
+// @return error
+//
+func (s *grpcServer) Get(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	group, err := lookupGroup(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	view, err := group.GetContext(withForwarded(ctx, in.GetForwarded()), in.GetKey())
+	if err != nil {
+		return nil, grpcStatus(err)
+	}
+	return &pb.Response{Value: view.ByteSlice(), Expire: toUnixNano(view.e)}, nil
+}
+
+//
+// Set
+// @Description: 处理远程节点的缓存写入请求
+// @receiver s
+// @param ctx
+// @param in
+// @return *pb.Response
+// @return error
+//
+func (s *grpcServer) Set(ctx context.Context, in *pb.SetRequest) (*pb.Response, error) {
+	group, err := lookupGroup(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	group.populateFromPeer(in.GetKey(), in)
+	return &pb.Response{}, nil
+}
+
+//
+// Remove
+// @Description: 处理远程节点的缓存删除请求
+// @receiver s
+// @param ctx
+// @param in
+// @return *pb.Response
+// @return error
+//
+func (s *grpcServer) Remove(ctx context.Context, in *pb.Request) (*pb.Response, error) {
+	group, err := lookupGroup(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	group.removeLocally(in.GetKey())
+	return &pb.Response{}, nil
+}
+
+//
+// GetMany
+// @Description: 处理远程节点的批量查询请求
+// @receiver s
+// @param ctx
+// @param in
+// @return *pb.BatchResponse
+// @return error
+//
+func (s *grpcServer) GetMany(ctx context.Context, in *pb.BatchRequest) (*pb.BatchResponse, error) {
+	group, err := lookupGroup(in.GetGroup())
+	if err != nil {
+		return nil, err
+	}
+	return batchResponse(withForwarded(ctx, in.GetForwarded()), group, in.GetKeys()), nil
+}
+
+func lookupGroup(name string) (*Group, error) {
+	group := GetGroup(name)
+	if group == nil {
+		//NotFound表示key不存在，未提供该Group视为节点暂不可用，调用方转向其余副本或本地加载
+		return nil, status.Errorf(codes.Unavailable, "group %s not found", name)
+	}
+	group.stats.serverRequests.Add(1)
+	return group, nil
+}
+
+//
+// grpcGetter
+// @Description: gRPC的实际客户端结构体，一个远程节点对应一条长连接
+//
+type grpcGetter struct {
+	conn   *grpc.ClientConn
+	client pb.GroupCacheClient
+	//请求耗时与错误统计
+	stats peerStats
+}
+
+//
+// String
+// @Description: 日志中以地址标识远程节点
+// @receiver g
+// @return string
+//
+func (g *grpcGetter) String() string {
+	return g.conn.Target()
+}
+
+//
+// Get
+// @Description: 通过长连接向远程节点查询缓存
+// @receiver g
+// @param ctx
+// @param in
+// @param out
+// @return error
+//
+func (g *grpcGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	start := g.stats.begin()
+	res, err := g.client.Get(ctx, in)
+	err = fromGRPCStatus(err)
+	g.stats.record(start, err)
+	if err != nil {
+		return err
+	}
+	proto.Merge(out, res)
+	return nil
+}
+
+//
+// Set
+// @Description: 通过长连接写入远程节点缓存
+// @receiver g
+// @param ctx
+// @param in
+// @param out
+// @return error
+//
+func (g *grpcGetter) Set(ctx context.Context, in *pb.SetRequest, out *pb.Response) error {
+	start := g.stats.begin()
+	res, err := g.client.Set(ctx, in)
+	g.stats.record(start, err)
+	if err != nil {
+		return err
+	}
+	proto.Merge(out, res)
+	return nil
+}
+
+//
+// Remove
+// @Description: 通过长连接删除远程节点缓存
+// @receiver g
+// @param ctx
+// @param in
+// @param out
+// @return error
+//
+func (g *grpcGetter) Remove(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	start := g.stats.begin()
+	res, err := g.client.Remove(ctx, in)
+	g.stats.record(start, err)
+	if err != nil {
+		return err
+	}
+	proto.Merge(out, res)
+	return nil
+}
+
+//
+// GetMany
+// @Description: 通过长连接批量查询远程节点缓存
+// @receiver g
+// @param ctx
+// @param in
+// @param out
+// @return error
+//
+func (g *grpcGetter) GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	start := g.stats.begin()
+	res, err := g.client.GetMany(ctx, in)
+	g.stats.record(start, err)
+	if err != nil {
+		return err
+	}
+	proto.Merge(out, res)
+	return nil
+}
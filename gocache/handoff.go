@@ -0,0 +1,158 @@
+package gocache
+
+import (
+	"context"
+	pb "gocache/gocachepb"
+	"sync"
+	"time"
+)
+
+const (
+	//交接失败的记录在该间隔后重试
+	handoffRetryInterval = 5 * time.Second
+)
+
+//
+// handoff
+// @Description: 节点变更后将不再由本节点负责的缓存推送给新的归属节点，避免新节点冷启动时大量请求落到回调函数。
+// 推送按速率限制，成功的记录从本地删除，失败的记录保留在本地等待重试，中断后重新遍历即可从断点继续
+//
+type handoff struct {
+	pool *HTTPPool
+	//每秒最多推送的记录数
+	rate int
+	mu   sync.Mutex
+	//取消正在进行的交接
+	cancel context.CancelFunc
+	//正在进行的交接结束时关闭
+	done chan struct{}
+	//失败重试的定时器
+	retry *time.Timer
+}
+
+//
+// start
+// @Description: 取消正在进行的交接，按最新的节点重新开始
+// @receiver h
+//
+func (h *handoff) start() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.cancel != nil {
+		h.cancel()
+	}
+	if h.retry != nil {
+		h.retry.Stop()
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	prev, done := h.done, make(chan struct{})
+	h.cancel, h.done = cancel, done
+	go func() {
+		defer close(done)
+		//等待上一轮退出，同一时刻只有一轮在推送
+		if prev != nil {
+			<-prev
+		}
+		h.run(ctx)
+	}()
+}
+
+//
+// run
+// @Description: 遍历使用该HTTPPool的Group进行交接，存在失败的记录时稍后重试
+// @receiver h
+// @param ctx
+//
+func (h *handoff) run(ctx context.Context) {
+	interval := time.Second / time.Duration(h.rate)
+	if interval <= 0 {
+		interval = time.Nanosecond
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	failed := 0
+	for _, g := range h.groups() {
+		moved, n := g.handoff(ctx, ticker.C)
+		failed += n
+		if moved > 0 || n > 0 {
+			h.pool.logger.Log(LevelInfo, "handed off keys", Field{"self", h.pool.self}, Field{"group", g.name},
+				Field{"moved", moved}, Field{"failed", n})
+		}
+		if ctx.Err() != nil {
+			return
+		}
+	}
+	if failed == 0 {
+		return
+	}
+	h.mu.Lock()
+	if ctx.Err() == nil {
+		h.retry = time.AfterFunc(handoffRetryInterval, h.start)
+	}
+	h.mu.Unlock()
+}
+
+//
+// groups
+// @Description: 返回使用该HTTPPool的Group
+// @receiver h
+// @return []*Group
+//
+func (h *handoff) groups() []*Group {
+	var list []*Group
+	for _, g := range allGroups() {
+		mu.RLock()
+		if g.peers == PeerPicker(h.pool) {
+			list = append(list, g)
+		}
+		mu.RUnlock()
+	}
+	return list
+}
+
+//
+// handoff
+// @Description: 将主缓存中本节点已不再是副本的记录推送给新的副本节点，每推送一条等待一次tick。
+// 新节点已加载的值不会被覆盖
+// @receiver g
+// @param ctx
+// @param tick
+// @return moved 推送成功并从本地删除的条数
+// @return failed 推送失败的条数
+//
+func (g *Group) handoff(ctx context.Context, tick <-chan time.Time) (moved, failed int) {
+	g.mainCache.rangeEntries(func(key string, value ByteView) bool {
+		replicas := g.pickReplicas(key)
+		if hasLocal(replicas) {
+			return true
+		}
+		//ctx已取消且tick同时就绪时select随机选择，先检查避免多推送一条
+		if ctx.Err() != nil {
+			return false
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-tick:
+		}
+		req := &pb.SetRequest{
+			Group:    g.name,
+			Key:      key,
+			Value:    value.b,
+			Expire:   toUnixNano(value.e),
+			IfAbsent: true,
+		}
+		for _, peer := range replicas {
+			if err := peer.Set(ctx, req, &pb.Response{}); err != nil {
+				g.logKey(LevelWarn, "failed to hand off to peer", key, Field{"peer", peer}, Field{"err", err})
+				failed++
+				return ctx.Err() == nil
+			}
+		}
+		g.mainCache.remove(key)
+		g.stats.handoffs.Add(1)
+		moved++
+		return true
+	})
+	return
+}
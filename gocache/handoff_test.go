@@ -0,0 +1,134 @@
+package gocache
+
+import (
+	"context"
+	pb "gocache/gocachepb"
+	"google.golang.org/protobuf/proto"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestGroupHandoff(t *testing.T) {
+	g := NewGroup("handoff", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("db-" + key), nil
+		}))
+	for _, key := range []string{"a", "b", "c"} {
+		g.Get(key)
+	}
+	setPeers := func(peers PeerPicker) {
+		mu.Lock()
+		g.peers = peers
+		mu.Unlock()
+	}
+	ticker := time.NewTicker(time.Millisecond)
+	defer ticker.Stop()
+
+	//本节点仍是副本时不交接
+	setPeers(fakeReplicas{&fakePeer{fail: true}, nil})
+	if moved, failed := g.handoff(context.Background(), ticker.C); moved != 0 || failed != 0 {
+		t.Fatalf("expected nothing to hand off, moved %d failed %d", moved, failed)
+	}
+
+	//推送失败的记录保留在本地
+	setPeers(fakeReplicas{&fakePeer{fail: true}})
+	if moved, failed := g.handoff(context.Background(), ticker.C); moved != 0 || failed != 3 {
+		t.Fatalf("expected 3 failed hand offs, moved %d failed %d", moved, failed)
+	}
+	if n := g.mainCache.stats().Items; n != 3 {
+		t.Fatalf("failed hand offs should stay in cache, got %d items", n)
+	}
+
+	//取消后停止推送
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	remote := &fakePeer{}
+	setPeers(fakeReplicas{remote})
+	if moved, _ := g.handoff(ctx, ticker.C); moved != 0 || len(remote.setKeys()) != 0 {
+		t.Fatalf("expected cancelled hand off to stop")
+	}
+
+	if moved, failed := g.handoff(context.Background(), ticker.C); moved != 3 || failed != 0 {
+		t.Fatalf("expected 3 keys handed off, moved %d failed %d", moved, failed)
+	}
+	if n := g.mainCache.stats().Items; n != 0 || len(remote.setKeys()) != 3 || g.Stats().Handoffs != 3 {
+		t.Fatalf("expected keys moved to new owner, %d left, sent %v", n, remote.setKeys())
+	}
+
+	//新归属节点已加载的值不会被覆盖
+	g.populateCache("k", ByteView{b: []byte("new")})
+	g.populateFromPeer("k", &pb.SetRequest{Value: []byte("old"), IfAbsent: true})
+	g.populateFromPeer("x", &pb.SetRequest{Value: []byte("old"), IfAbsent: true})
+	if v, _ := g.mainCache.get("k"); v.String() != "new" {
+		t.Fatalf("hand off overwrote value loaded by new owner: %q", v.String())
+	}
+	if v, _ := g.mainCache.get("x"); v.String() != "old" {
+		t.Fatalf("expected handed off value to be stored, got %q", v.String())
+	}
+}
+
+func TestHTTPPoolHandoff(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received = make(map[string]*pb.SetRequest)
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		req := &pb.SetRequest{}
+		if r.Method != http.MethodPut || proto.Unmarshal(body, req) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		mu.Lock()
+		received[req.Key] = req
+		mu.Unlock()
+	}))
+	defer server.Close()
+
+	pool := NewHTTPPool("http://self", WithHandoff(1000))
+	pool.Set("http://self")
+	g := NewGroup("http-handoff", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("db-" + key), nil
+		}))
+	g.RegisterPeers(pool)
+	for i := 0; i < 20; i++ {
+		g.Get(strconv.Itoa(i))
+	}
+
+	pool.AddPeers(server.URL)
+	moved := 0
+	for i := 0; i < 20; i++ {
+		if _, ok := pool.PickPeer(strconv.Itoa(i)); ok {
+			moved++
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for g.Stats().Handoffs < int64(moved) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected %d keys handed off, got %d", moved, g.Stats().Handoffs)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(received) != moved || moved == 0 {
+		t.Fatalf("expected %d keys pushed to new owner, got %d", moved, len(received))
+	}
+	for key, req := range received {
+		if !req.IfAbsent || string(req.Value) != "db-"+key {
+			t.Fatalf("unexpected hand off request %v", req)
+		}
+		if _, ok := g.mainCache.get(key); ok {
+			t.Fatalf("handed off key %s should be removed locally", key)
+		}
+	}
+	if n := g.mainCache.stats().Items; n != int64(20-moved) {
+		t.Fatalf("expected %d keys left locally, got %d", 20-moved, n)
+	}
+}
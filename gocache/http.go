@@ -1,21 +1,30 @@
 package gocache
 
 import (
+	"bytes"
+	"context"
 	"fmt"
-	"gocache/consistenthash"
 	pb "gocache/gocachepb"
 	"google.golang.org/protobuf/proto"
+	"io"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"net/url"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 )
 
 const (
 	defaultBasePath = "/_gocache/"
 	defaultReplicas = 50
+	//向远程节点传递调用方剩余的超时时间
+	timeoutHeader = "X-Gocache-Timeout"
+	//标记请求由其余节点转发而来
+	forwardedHeader = "X-Gocache-Forwarded"
+	//响应体为protobuf时的Content-Type，出错时据此判断能否还原错误类型
+	protobufContentType = "application/x-protobuf"
 )
 
 type HTTPPool struct {
@@ -24,28 +33,77 @@ type HTTPPool struct {
 	//节点通讯地址前缀
 	basePath string
 	mu       sync.Mutex
-	//一致性哈希Map
-	peers *consistenthash.Map
+	//节点分布算法，默认为一致性哈希环
+	peers        Placement
+	newPlacement PlacementFunc
 	//本地客户端获取远程节点数据map
 	httpGetters map[string]*httpGetter
+	//运维管理接口前缀，为空表示不开启
+	adminPath string
+	//运维管理接口的访问令牌，开启管理接口时必须设置
+	adminToken string
+	//指标接口路径，为空表示不开启
+	metricsPath string
+	//有界负载的容量系数，0表示不开启
+	loadFactor float64
+	//每个key保存的副本数，包括归属节点
+	replication int
+	//节点变更后每秒最多交接的记录数，0表示不交接
+	handoffRate int
+	handoff     *handoff
+	//分级日志，默认不输出请求级别的日志
+	logger Logger
+	//按名称查找处理请求的Group，默认为GetGroup，测试中同一进程内的多个节点可各自使用独立的Group
+	getGroup func(name string) *Group
 }
 
-func NewHTTPPool(self string) *HTTPPool {
-	return &HTTPPool{
-		self:     self,
-		basePath: defaultBasePath,
+//
+// NewHTTPPool
+// @Description: 实例化HTTPPool
+// @param self
+// @param opts
+// @return *HTTPPool
+//
+func NewHTTPPool(self string, opts ...HTTPPoolOption) *HTTPPool {
+	p := &HTTPPool{
+		self:         self,
+		basePath:     defaultBasePath,
+		newPlacement: ConsistentHash,
+		replication:  1,
+		logger:       defaultLogger,
+		getGroup:     GetGroup,
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.adminPath != "" && p.adminToken == "" {
+		panic("admin path requires an admin token")
 	}
+	//容量系数小于1时所有节点都会超载，0表示未开启
+	if p.loadFactor != 0 && p.loadFactor < 1 {
+		panic("bounded load factor must be at least 1")
+	}
+	if p.replication < 1 {
+		panic("replication must be at least 1")
+	}
+	//副本查询按固定顺序访问节点，不会按负载顺延，两者不能同时开启
+	if p.loadFactor > 0 && p.replication > 1 {
+		panic("bounded load cannot be combined with replication")
+	}
+	return p
 }
 
 //
 // Log
-// @Description:
+// @Description: 以Info级别输出带节点地址的日志
 // @receiver p
 // @param format
 // @param v
 //
 func (p *HTTPPool) Log(format string, v ...interface{}) {
-	log.Printf("[Server %s] %s", p.self, fmt.Sprintf(format, v...))
+	if p.logger.Enabled(LevelInfo) {
+		p.logger.Log(LevelInfo, fmt.Sprintf(format, v...), Field{"self", p.self})
+	}
 }
 
 //
@@ -56,10 +114,17 @@ func (p *HTTPPool) Log(format string, v ...interface{}) {
 // @param r
 //
 func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if p.adminPath != "" && strings.HasPrefix(r.URL.Path, p.adminPath) {
+		p.serveAdmin(w, r)
+		return
+	}
+	if p.metricsPath != "" && r.URL.Path == p.metricsPath {
+		p.serveMetrics(w, r)
+		return
+	}
 	if !strings.HasPrefix(r.URL.Path, p.basePath) {
 		panic("HTTPPool serving unexpected path:" + r.URL.Path)
 	}
-	p.Log("%s %s", r.Method, r.URL.Path)
 	parts := strings.SplitN(r.URL.Path[len(p.basePath):], "/", 2)
 	if len(parts) != 2 {
 		http.Error(w, "bad request", http.StatusBadRequest)
@@ -67,42 +132,350 @@ func (p *HTTPPool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	}
 	groupName := parts[0]
 	key := parts[1]
+	if p.logger.Enabled(LevelDebug) {
+		p.logger.Log(LevelDebug, "serve peer request", Field{"self", p.self}, Field{"method", r.Method},
+			Field{"group", groupName}, keyHashField(key))
+	}
 
-	group := GetGroup(groupName)
+	group := p.getGroup(groupName)
 	if group == nil {
-		http.Error(w, fmt.Sprintf("group %s not found", groupName), http.StatusNotFound)
+		//404表示key不存在，未提供该Group视为节点暂不可用，与gRPC的Unavailable一致
+		writeResponse(w, &pb.Response{Code: pb.Code_UNAVAILABLE, Error: fmt.Sprintf("group %s not found", groupName)})
 		return
 	}
-	view, err := group.Get(key)
+	group.stats.serverRequests.Add(1)
+	switch r.Method {
+	case http.MethodPost:
+		p.serveGetMany(w, r, group)
+	case http.MethodPut:
+		p.serveSet(w, r, group, key)
+	case http.MethodDelete:
+		group.removeLocally(key)
+		w.WriteHeader(http.StatusOK)
+	default:
+		p.serveGet(w, r, group, key)
+	}
+}
+
+//
+// serveGet
+// @Description: 处理远程节点的缓存查询请求
+// @receiver p
+// @param w
+// @param r
+// @param group
+// @param key
+//
+func (p *HTTPPool) serveGet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	ctx, cancel := requestContext(r)
+	defer cancel()
+	ctx = withForwarded(ctx, r.Header.Get(forwardedHeader) != "")
+	res := &pb.Response{}
+	view, err := group.GetContext(ctx, key)
+	if err != nil {
+		res = errorResponse(err)
+	} else {
+		res.Value, res.Expire = view.ByteSlice(), toUnixNano(view.e)
+	}
+	writeResponse(w, res)
+}
+
+//
+// writeResponse
+// @Description: 以protobuf编码写入Response，状态码由错误类型决定
+// @param w
+// @param res
+//
+func writeResponse(w http.ResponseWriter, res *pb.Response) {
 	//对查询结果用protobuf封装
-	body, err := proto.Marshal(&pb.Response{Value: view.ByteSlice()})
+	body, err := proto.Marshal(res)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Type", protobufContentType)
+	w.WriteHeader(httpStatus(res.Code))
 	//返回拷贝
 	w.Write(body)
 }
 
+//
+// serveSet
+// @Description: 处理远程节点的缓存写入请求，请求体为protobuf编码的SetRequest
+// @receiver p
+// @param w
+// @param r
+// @param group
+// @param key
+//
+func (p *HTTPPool) serveSet(w http.ResponseWriter, r *http.Request, group *Group, key string) {
+	bytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &pb.SetRequest{}
+	if err = proto.Unmarshal(bytes, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	group.populateFromPeer(key, req)
+	w.WriteHeader(http.StatusOK)
+}
+
+//
+// serveGetMany
+// @Description: 处理远程节点的批量查询请求，请求体为protobuf编码的BatchRequest
+// @receiver p
+// @param w
+// @param r
+// @param group
+//
+func (p *HTTPPool) serveGetMany(w http.ResponseWriter, r *http.Request, group *Group) {
+	bytes, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	req := &pb.BatchRequest{}
+	if err = proto.Unmarshal(bytes, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	ctx, cancel := requestContext(r)
+	defer cancel()
+	ctx = withForwarded(ctx, req.GetForwarded())
+	body, err := proto.Marshal(batchResponse(ctx, group, req.GetKeys()))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", protobufContentType)
+	w.Write(body)
+}
+
+//
+// requestContext
+// @Description: 客户端断开时取消ctx，并还原调用方传递的截止时间
+// @param r
+// @return context.Context
+// @return context.CancelFunc
+//
+func requestContext(r *http.Request) (context.Context, context.CancelFunc) {
+	if timeout, err := time.ParseDuration(r.Header.Get(timeoutHeader)); err == nil {
+		return context.WithTimeout(r.Context(), timeout)
+	}
+	return context.WithCancel(r.Context())
+}
+
 //
 // Set
-// @Description: 实例化一致性哈希算法，并传入实例节点
+// @Description: 实例化节点分布算法，并按地址顺序传入实例节点，各节点配置的顺序不同时也得到相同结果
 // @receiver p
 // @param peers
 //
 func (p *HTTPPool) Set(peers ...string) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
-	p.peers = consistenthash.New(defaultReplicas, nil)
-	//在表中增加节点
-	p.peers.Add(peers...)
+	defer p.ringChanged()
+	p.peers = p.newPlacement()
 	p.httpGetters = make(map[string]*httpGetter, len(peers))
+	sorted := append([]string(nil), peers...)
+	sort.Strings(sorted)
+	p.addPeers(sorted...)
+}
+
+//
+// SetWeighted
+// @Description: 按权重实例化节点分布算法，节点负责的key数量与权重成正比，权重不大于0的节点会被忽略。
+// 节点分布算法不支持权重时所有节点权重均为1
+// @receiver p
+// @param weights 节点地址到权重的映射
+//
+func (p *HTTPPool) SetWeighted(weights map[string]int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.ringChanged()
+	p.peers = p.newPlacement()
+	p.httpGetters = make(map[string]*httpGetter, len(weights))
+	//按地址顺序加入，与加入顺序有关的算法在各节点上得到相同结果
+	peers := make([]string, 0, len(weights))
+	for peer := range weights {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	for _, peer := range peers {
+		p.setWeight(peer, weights[peer])
+	}
+}
+
+//
+// SetWeight
+// @Description: 运行时调整节点权重，节点不存在时以该权重加入，权重不大于0时移除节点，节点分布算法按地址顺序重建
+// @receiver p
+// @param peer
+// @param weight
+//
+func (p *HTTPPool) SetWeight(peer string, weight int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.ringChanged()
+	weights := p.weights()
+	weights[peer] = weight
+	p.rebuild(weights)
+}
+
+func (p *HTTPPool) setWeight(peer string, weight int) {
+	if wp, ok := p.peers.(WeightedPlacement); ok {
+		wp.SetWeight(peer, weight)
+	} else if weight > 0 {
+		p.peers.Add(peer)
+	} else {
+		p.peers.Remove(peer)
+	}
+	if weight <= 0 {
+		delete(p.httpGetters, peer)
+		return
+	}
+	if _, ok := p.httpGetters[peer]; !ok {
+		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
+	}
+}
+
+//
+// Weights
+// @Description: 返回当前哈希环上各节点的权重
+// @receiver p
+// @return map[string]int
+//
+func (p *HTTPPool) Weights() map[string]int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.weights()
+}
+
+func (p *HTTPPool) weights() map[string]int {
+	weights := make(map[string]int, len(p.httpGetters))
+	for peer := range p.httpGetters {
+		weights[peer] = 1
+		if wp, ok := p.peers.(WeightedPlacement); ok {
+			weights[peer] = wp.Weight(peer)
+		}
+	}
+	return weights
+}
+
+//
+// rebuild
+// @Description: 按地址顺序重建节点分布算法，结果只取决于节点集合，与运行时增删节点的历史无关，
+// jump等与加入顺序有关的算法在重启的节点与运行时变更的节点上也得到相同结果。已有节点的httpGetter被保留，调用方需持有p.mu
+// @receiver p
+// @param weights 节点地址到权重的映射，权重不大于0的节点会被移除
+//
+func (p *HTTPPool) rebuild(weights map[string]int) {
+	p.peers = p.newPlacement()
+	if p.httpGetters == nil {
+		p.httpGetters = make(map[string]*httpGetter, len(weights))
+	}
+	peers := make([]string, 0, len(weights))
+	for peer, weight := range weights {
+		if weight > 0 {
+			peers = append(peers, peer)
+		}
+	}
+	sort.Strings(peers)
+	for peer := range p.httpGetters {
+		if weights[peer] <= 0 {
+			delete(p.httpGetters, peer)
+		}
+	}
+	for _, peer := range peers {
+		p.setWeight(peer, weights[peer])
+	}
+}
+
+//
+// AddPeers
+// @Description: 增量加入节点，已存在的节点会被忽略，节点分布算法按地址顺序重建
+// @receiver p
+// @param peers
+//
+func (p *HTTPPool) AddPeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.ringChanged()
+	weights := p.weights()
+	for _, peer := range peers {
+		if _, ok := weights[peer]; !ok {
+			weights[peer] = 1
+		}
+	}
+	p.rebuild(weights)
+}
+
+func (p *HTTPPool) addPeers(peers ...string) {
 	for _, peer := range peers {
+		if _, ok := p.httpGetters[peer]; ok {
+			continue
+		}
+		//在表中增加节点
+		p.peers.Add(peer)
 		p.httpGetters[peer] = &httpGetter{baseURL: peer + p.basePath}
 	}
 }
 
+//
+// RemovePeers
+// @Description: 增量移除节点，节点分布算法按地址顺序重建
+// @receiver p
+// @param peers
+//
+func (p *HTTPPool) RemovePeers(peers ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	defer p.ringChanged()
+	if p.peers == nil {
+		return
+	}
+	weights := p.weights()
+	for _, peer := range peers {
+		delete(weights, peer)
+	}
+	p.rebuild(weights)
+}
+
+//
+// ringChanged
+// @Description: 节点变更后开始交接缓存，调用方需持有p.mu
+// @receiver p
+//
+func (p *HTTPPool) ringChanged() {
+	if p.handoffRate <= 0 {
+		return
+	}
+	if p.handoff == nil {
+		p.handoff = &handoff{pool: p, rate: p.handoffRate}
+	}
+	p.handoff.start()
+}
+
+//
+// Peers
+// @Description: 返回当前哈希环上的全部节点
+// @receiver p
+// @return []string
+//
+func (p *HTTPPool) Peers() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	peers := make([]string, 0, len(p.httpGetters))
+	for peer := range p.httpGetters {
+		peers = append(peers, peer)
+	}
+	sort.Strings(peers)
+	return peers
+}
+
 //
 // PickPeer
 // @Description: 哈希列表中调用实际节点
@@ -114,46 +487,228 @@ func (p *HTTPPool) Set(peers ...string) {
 func (p *HTTPPool) PickPeer(key string) (PeerGetter, bool) {
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	if p.peers == nil {
+		return nil, false
+	}
+	peer := ""
+	if bp, ok := p.peers.(BoundedPlacement); ok && p.loadFactor > 0 {
+		peer = bp.GetBounded(key, p.loadFactor, p.load)
+	} else {
+		peer = p.peers.Get(key)
+	}
 	//调用不为空，且不为本身节点
-	if peer := p.peers.Get(key); peer != "" && peer != p.self {
-		p.Log("pick peer %s", peer)
+	if peer != "" && peer != p.self {
+		if p.logger.Enabled(LevelDebug) {
+			p.logger.Log(LevelDebug, "pick peer", Field{"self", p.self}, Field{"peer", peer}, keyHashField(key))
+		}
 		return p.httpGetters[peer], true
 	}
 	return nil, false
 }
 
+//
+// PickReplicas
+// @Description: 返回key的全部副本节点，本节点对应的元素为nil。未开启多副本或节点分布算法不支持时只返回归属节点
+// @receiver p
+// @param key
+// @return []PeerGetter
+//
+func (p *HTTPPool) PickReplicas(key string) []PeerGetter {
+	p.mu.Lock()
+	rp, ok := p.peers.(ReplicatedPlacement)
+	if !ok || p.replication <= 1 {
+		p.mu.Unlock()
+		if peer, ok := p.PickPeer(key); ok {
+			return []PeerGetter{peer}
+		}
+		return []PeerGetter{nil}
+	}
+	defer p.mu.Unlock()
+	nodes := rp.GetN(key, p.replication)
+	replicas := make([]PeerGetter, len(nodes))
+	for i, node := range nodes {
+		if node != p.self {
+			replicas[i] = p.httpGetters[node]
+		}
+	}
+	return replicas
+}
+
+//
+// load
+// @Description: 节点负载为本节点发往该节点且尚未完成的请求数，本节点的本地加载不经过httpGetter，负载视为0
+// @receiver p
+// @param peer
+// @return int64
+//
+func (p *HTTPPool) load(peer string) int64 {
+	if getter, ok := p.httpGetters[peer]; ok && peer != p.self {
+		return getter.stats.inflight.Get()
+	}
+	return 0
+}
+
+//
+// PeerStats
+// @Description: 返回客户端视角下各远程节点的请求统计
+// @receiver p
+// @return map[string]PeerStats
+//
+func (p *HTTPPool) PeerStats() map[string]PeerStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	stats := make(map[string]PeerStats, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			stats[peer] = getter.stats.snapshot()
+		}
+	}
+	return stats
+}
+
 //
 // httpGetter
 // @Description: http的实际客户端结构体，一个远程节点对应一个结构体
 //
 type httpGetter struct {
 	baseURL string
+	//请求耗时与错误统计
+	stats peerStats
+}
+
+//
+// String
+// @Description: 日志中以地址标识远程节点
+// @receiver g
+// @return string
+//
+func (g *httpGetter) String() string {
+	return g.baseURL
 }
 
 //
 // Get
-// @Description:
+// @Description: 以GET请求查询远程节点缓存
 // @receiver g
-// @param group
-// @param key
-// @return []byte
+// @param ctx
+// @param in
+// @param out
+// @return error
+//
+func (g *httpGetter) Get(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	ctx = withForwarded(ctx, in.GetForwarded())
+	return g.do(ctx, http.MethodGet, g.url(in.GetGroup(), in.GetKey()), nil, out)
+}
+
+//
+// Set
+// @Description: 以PUT请求写入远程节点缓存
+// @receiver g
+// @param in
+// @param out
 // @return error
 //
-func (g *httpGetter) Get(in *pb.Request, out *pb.Response) error {
-	u := fmt.Sprintf(
+func (g *httpGetter) Set(ctx context.Context, in *pb.SetRequest, out *pb.Response) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encoding request body error:%v", err)
+	}
+	return g.do(ctx, http.MethodPut, g.url(in.GetGroup(), in.GetKey()), bytes.NewReader(body), nil)
+}
+
+//
+// Remove
+// @Description: 以DELETE请求删除远程节点缓存
+// @receiver g
+// @param in
+// @param out
+// @return error
+//
+func (g *httpGetter) Remove(ctx context.Context, in *pb.Request, out *pb.Response) error {
+	return g.do(ctx, http.MethodDelete, g.url(in.GetGroup(), in.GetKey()), nil, nil)
+}
+
+//
+// GetMany
+// @Description: 以POST请求批量查询远程节点缓存，请求路径中key为空
+// @receiver g
+// @param ctx
+// @param in
+// @param out
+// @return error
+//
+func (g *httpGetter) GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error {
+	body, err := proto.Marshal(in)
+	if err != nil {
+		return fmt.Errorf("encoding request body error:%v", err)
+	}
+	return g.do(ctx, http.MethodPost, g.url(in.GetGroup(), ""), bytes.NewReader(body), out)
+}
+
+func (g *httpGetter) url(group, key string) string {
+	return fmt.Sprintf(
 		"%v%v/%v",
 		g.baseURL,
-		url.QueryEscape(in.GetGroup()),
-		url.QueryEscape(in.GetKey()),
+		url.QueryEscape(group),
+		url.QueryEscape(key),
 	)
+}
+
+//
+// newRequest
+// @Description: 构造携带ctx的请求，ctx存在截止时间时一并告知远程节点
+// @receiver g
+// @param ctx
+// @param method
+// @param u
+// @param body
+// @return *http.Request
+// @return error
+//
+func (g *httpGetter) newRequest(ctx context.Context, method, u string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		req.Header.Set(timeoutHeader, time.Until(deadline).String())
+	}
+	if isForwarded(ctx) {
+		req.Header.Set(forwardedHeader, "1")
+	}
+	return req, nil
+}
+
+//
+// do
+// @Description: 发出http请求，out不为空时将响应体解码至out
+// @receiver g
+// @param ctx
+// @param method
+// @param u
+// @param body
+// @param out
+// @return error
+//
+func (g *httpGetter) do(ctx context.Context, method, u string, body io.Reader, out proto.Message) (err error) {
+	defer func(start time.Time) {
+		g.stats.record(start, err)
+	}(g.stats.begin())
+	req, err := g.newRequest(ctx, method, u, body)
+	if err != nil {
+		return err
+	}
 	//发出http请求
-	res, err := http.Get(u)
+	res, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
 	defer res.Body.Close()
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned:%v", res.Status)
+		return statusError(res)
+	}
+	if out == nil {
+		return nil
 	}
 	bytes, err := ioutil.ReadAll(res.Body)
 	if err != nil {
@@ -164,3 +719,23 @@ func (g *httpGetter) Get(in *pb.Request, out *pb.Response) error {
 	}
 	return nil
 }
+
+//
+// statusError
+// @Description: 将非200响应还原为错误，响应体为protobuf编码的Response时保留错误类型
+// @param res
+// @return error
+//
+func statusError(res *http.Response) error {
+	if res.Header.Get("Content-Type") == protobufContentType {
+		if bytes, err := ioutil.ReadAll(res.Body); err == nil {
+			out := &pb.Response{}
+			if proto.Unmarshal(bytes, out) == nil {
+				if err = responseError(out); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return fmt.Errorf("server returned:%v", res.Status)
+}
@@ -0,0 +1,64 @@
+package fnv1a
+
+const (
+	offset32 = 2166136261
+	prime32  = 16777619
+	offset64 = 14695981039346656037
+	prime64  = 1099511628211
+)
+
+//
+// Sum32
+// @Description: 32位FNV-1a哈希，直接遍历字符串避免内存分配
+// @param s
+// @return uint32
+//
+func Sum32(s string) uint32 {
+	h := uint32(offset32)
+	for i := 0; i < len(s); i++ {
+		h ^= uint32(s[i])
+		h *= prime32
+	}
+	return h
+}
+
+//
+// Sum64
+// @Description: 64位FNV-1a哈希，直接遍历字符串避免内存分配
+// @param s
+// @return uint64
+//
+func Sum64(s string) uint64 {
+	return Sum64Seed(s, 0)
+}
+
+//
+// Sum64Seed
+// @Description: 以seed扰动初始值的64位FNV-1a哈希，seed为0时与Sum64相同
+// @param s
+// @param seed
+// @return uint64
+//
+func Sum64Seed(s string, seed uint64) uint64 {
+	h := uint64(offset64) ^ seed
+	for i := 0; i < len(s); i++ {
+		h ^= uint64(s[i])
+		h *= prime64
+	}
+	return h
+}
+
+//
+// Mix64
+// @Description: splitmix64的终结函数，使各位充分混合，改善FNV-1a对短字符串的低位分布
+// @param h
+// @return uint64
+//
+func Mix64(h uint64) uint64 {
+	h ^= h >> 30
+	h *= 0xbf58476d1ce4e5b9
+	h ^= h >> 27
+	h *= 0x94d049bb133111eb
+	h ^= h >> 31
+	return h
+}
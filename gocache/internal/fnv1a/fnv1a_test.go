@@ -0,0 +1,24 @@
+package fnv1a
+
+import (
+	"hash/fnv"
+	"testing"
+)
+
+func TestSum(t *testing.T) {
+	for _, s := range []string{"", "a", "key", "http://localhost:8001"} {
+		h32 := fnv.New32a()
+		h32.Write([]byte(s))
+		if got := Sum32(s); got != h32.Sum32() {
+			t.Fatalf("Sum32(%q) = %x, want %x", s, got, h32.Sum32())
+		}
+		h64 := fnv.New64a()
+		h64.Write([]byte(s))
+		if got := Sum64(s); got != h64.Sum64() {
+			t.Fatalf("Sum64(%q) = %x, want %x", s, got, h64.Sum64())
+		}
+	}
+	if Sum64Seed("key", 1) == Sum64("key") {
+		t.Fatalf("expected seed to change the hash")
+	}
+}
@@ -0,0 +1,102 @@
+package jump
+
+import "gocache/internal/fnv1a"
+
+//
+// Map
+// @Description: Jump一致性哈希，key直接映射到[0, n)内的桶编号，无需虚拟节点，内存占用与节点数成正比且分布均匀。
+// 桶编号由节点加入的顺序决定，各进程必须以相同顺序增删节点
+//
+type Map struct {
+	//下标即桶编号
+	nodes []string
+	index map[string]int
+}
+
+//
+// New
+// @Description: 实例化Map
+// @return *Map
+//
+func New() *Map {
+	return &Map{index: make(map[string]int)}
+}
+
+//
+// Hash
+// @Description: Lamping与Veach提出的jump consistent hash，返回key所在的桶编号，
+// 桶数由n增加到n+1时只有1/(n+1)的key移动到新桶
+// @param key
+// @param buckets
+// @return int
+//
+func Hash(key uint64, buckets int) int {
+	var b, j int64 = -1, 0
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+//
+// Add
+// @Description: 在末尾追加节点，已存在的节点会被忽略
+// @receiver m
+// @param keys
+//
+func (m *Map) Add(keys ...string) {
+	for _, key := range keys {
+		if _, ok := m.index[key]; ok {
+			continue
+		}
+		m.index[key] = len(m.nodes)
+		m.nodes = append(m.nodes, key)
+	}
+}
+
+//
+// Remove
+// @Description: 删除节点，jump hash只能减少最后一个桶，因此将最后一个节点移入被删除节点的桶，
+// 被删除节点与最后一个节点的key会移动，其余key保持不变
+// @receiver m
+// @param keys
+//
+func (m *Map) Remove(keys ...string) {
+	for _, key := range keys {
+		i, ok := m.index[key]
+		if !ok {
+			continue
+		}
+		last := len(m.nodes) - 1
+		m.nodes[i] = m.nodes[last]
+		m.index[m.nodes[i]] = i
+		m.nodes = m.nodes[:last]
+		delete(m.index, key)
+	}
+}
+
+//
+// Get
+// @Description: 返回key所在桶的节点
+// @receiver m
+// @param key
+// @return string
+//
+func (m *Map) Get(key string) string {
+	if len(key) == 0 || m.IsEmpty() {
+		return ""
+	}
+	return m.nodes[Hash(fnv1a.Sum64(key), len(m.nodes))]
+}
+
+//
+// IsEmpty
+// @Description: 是否没有节点
+// @receiver m
+// @return bool
+//
+func (m *Map) IsEmpty() bool {
+	return len(m.nodes) == 0
+}
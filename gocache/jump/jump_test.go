@@ -0,0 +1,95 @@
+package jump
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func owners(m *Map, n int) []string {
+	owners := make([]string, n)
+	for i := range owners {
+		owners[i] = m.Get(strconv.Itoa(i))
+	}
+	return owners
+}
+
+func TestHash(t *testing.T) {
+	for key := uint64(0); key < 1000; key++ {
+		if b := Hash(key, 1); b != 0 {
+			t.Fatalf("expected single bucket, got %d", b)
+		}
+		//桶数增加时key要么不动，要么移动到新桶
+		for n := 1; n < 20; n++ {
+			if b, next := Hash(key, n), Hash(key, n+1); b != next && next != n {
+				t.Fatalf("key %d moved from bucket %d to %d when growing to %d buckets", key, b, next, n+1)
+			}
+		}
+	}
+}
+
+func TestMovement(t *testing.T) {
+	const keys = 100000
+	m := New()
+	if m.Get("k") != "" {
+		t.Fatalf("expected empty map to return no node")
+	}
+	for i := 0; i < 10; i++ {
+		m.Add("node" + strconv.Itoa(i))
+	}
+	before := owners(m, keys)
+
+	m.Add("node10")
+	moved := 0
+	for i, owner := range owners(m, keys) {
+		if owner != before[i] {
+			if owner != "node10" {
+				t.Fatalf("key %d moved from %s to %s", i, before[i], owner)
+			}
+			moved++
+		}
+	}
+	if ratio := float64(moved) / keys; math.Abs(ratio-1.0/11) > 0.01 {
+		t.Fatalf("expected about 1/11 keys to move on add, got %.4f", ratio)
+	}
+
+	//删除中间的节点时最后一个节点移入其桶，只有这两个节点的key移动
+	before = owners(m, keys)
+	m.Remove("node3")
+	moved = 0
+	for i, owner := range owners(m, keys) {
+		if owner == "node3" {
+			t.Fatalf("key %d still owned by removed node", i)
+		}
+		if owner != before[i] {
+			if before[i] != "node3" && before[i] != "node10" {
+				t.Fatalf("key %d moved from %s to %s", i, before[i], owner)
+			}
+			moved++
+		}
+	}
+	if ratio := float64(moved) / keys; ratio > 2.0/11+0.01 {
+		t.Fatalf("expected at most about 2/11 keys to move on remove, got %.4f", ratio)
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	const keys = 100000
+	m := New()
+	for i := 0; i < 10; i++ {
+		m.Add("node" + strconv.Itoa(i))
+	}
+	counts := make(map[string]int)
+	for _, owner := range owners(m, keys) {
+		counts[owner]++
+	}
+	var sum, sq float64
+	for _, c := range counts {
+		sum += float64(c)
+		sq += float64(c) * float64(c)
+	}
+	mean := sum / 10
+	if cv := math.Sqrt(sq/10-mean*mean) / mean; len(counts) != 10 || cv > 0.05 {
+		t.Fatalf("coefficient of variation %.4f too high: %v", cv, counts)
+	}
+}
@@ -0,0 +1,67 @@
+package gocache
+
+import "time"
+
+//
+// L2Cache
+// @Description: 主缓存的二级缓存，通常位于本地磁盘，容量远大于内存。主缓存因容量淘汰的记录写入其中，
+// Get未命中主缓存且本节点为副本节点时先查找二级缓存，再查询远程节点与回调函数。同一key只保存在主缓存与二级缓存之一，实现需并发安全
+//
+type L2Cache interface {
+	//expire为零值表示永不过期，已过期的记录视为不存在
+	Get(key string) (value []byte, expire time.Time, ok bool)
+	Put(key string, value []byte, expire time.Time) error
+	Remove(key string)
+}
+
+//
+// spill
+// @Description: 主缓存淘汰的记录写入二级缓存，已过期的记录直接丢弃
+// @receiver g
+// @param key
+// @param value
+//
+func (g *Group) spill(key string, value ByteView) {
+	if !value.e.IsZero() && !time.Now().Before(value.e) {
+		return
+	}
+	if err := g.l2.Put(key, value.b, value.e); err != nil {
+		g.logKey(LevelWarn, "failed to spill to l2 cache", key, Field{"err", err})
+		return
+	}
+	g.stats.l2Spills.Add(1)
+}
+
+//
+// lookupL2
+// @Description: 在二级缓存中查找，命中时移回主缓存
+// @receiver g
+// @param key
+// @return ByteView
+// @return bool
+//
+func (g *Group) lookupL2(key string) (ByteView, bool) {
+	if g.l2 == nil {
+		return ByteView{}, false
+	}
+	b, e, ok := g.l2.Get(key)
+	if !ok {
+		return ByteView{}, false
+	}
+	g.stats.l2Hits.Add(1)
+	value := ByteView{b: b, e: e, l: time.Now()}
+	g.populateCache(key, value)
+	return value, true
+}
+
+//
+// dropL2
+// @Description: 从二级缓存中删除记录，用于本节点不再负责该key时
+// @receiver g
+// @param key
+//
+func (g *Group) dropL2(key string) {
+	if g.l2 != nil {
+		g.l2.Remove(key)
+	}
+}
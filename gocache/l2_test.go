@@ -0,0 +1,106 @@
+package gocache
+
+import (
+	"gocache/diskcache"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestL2Cache(t *testing.T) {
+	store, err := diskcache.Open(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	loads := make(map[string]int)
+	//每条记录占6字节，主缓存只能容纳2条
+	g := NewGroup("l2", 12, GetterFunc(
+		func(key string) ([]byte, error) {
+			loads[key]++
+			return []byte("v-" + key), nil
+		}), WithShards(1), WithL2Cache(store))
+	for i := 0; i < 4; i++ {
+		g.Get("k" + strconv.Itoa(i))
+	}
+	//k0与k1被淘汰至二级缓存
+	if store.Len() != 2 || g.Stats().L2Spills != 2 {
+		t.Fatalf("expected 2 spilled keys, got %d", store.Len())
+	}
+	view, err := g.Get("k0")
+	if err != nil || view.String() != "v-k0" {
+		t.Fatalf("unexpected value %q %v", view.String(), err)
+	}
+	if loads["k0"] != 1 || g.Stats().L2Hits != 1 {
+		t.Fatalf("expected k0 to be served from l2, loaded %d times", loads["k0"])
+	}
+	//k0移回主缓存，k2被淘汰，同一key只保存在一级
+	if _, _, ok := store.Get("k0"); ok {
+		t.Fatalf("expected k0 to leave l2 after promotion")
+	}
+	if _, _, ok := store.Get("k2"); !ok {
+		t.Fatalf("expected k2 to be spilled")
+	}
+	//批量获取同样先查询二级缓存
+	if values, errs := g.GetMany([]string{"k2"}); errs[0] != nil || values[0].String() != "v-k2" || loads["k2"] != 1 {
+		t.Fatalf("expected k2 to be served from l2, got %q %v, loaded %d times", values[0].String(), errs[0], loads["k2"])
+	}
+	//删除时同时清除二级缓存，下次Get重新加载
+	if err = g.Remove("k1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := store.Get("k1"); ok {
+		t.Fatalf("expected k1 to be removed from l2")
+	}
+	g.Get("k1")
+	if loads["k1"] != 2 {
+		t.Fatalf("expected k1 to be reloaded, loaded %d times", loads["k1"])
+	}
+}
+
+func TestL2CacheSkipsExpired(t *testing.T) {
+	store, err := diskcache.Open(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	g := NewGroup("l2-expired", 6, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v-" + key), nil
+		}), WithShards(1), WithExpiration(10*time.Millisecond), WithL2Cache(store))
+	g.Get("k0")
+	time.Sleep(20 * time.Millisecond)
+	g.Get("k1")
+	if store.Len() != 0 {
+		t.Fatalf("expected expired entry not to be spilled, got %d", store.Len())
+	}
+}
+
+func TestL2CacheSkipsMovedKeys(t *testing.T) {
+	store, err := diskcache.Open(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	g := NewGroup("l2-moved", 2<<10, GetterFunc(
+		func(key string) ([]byte, error) {
+			return []byte("v-" + key), nil
+		}), WithL2Cache(store))
+	//本节点曾是k的归属节点，节点变更后k归属远程节点
+	store.Put("k", []byte("stale"), time.Time{})
+	g.RegisterPeers(fakeReplicas{&fakePeer{}})
+	view, err := g.Get("k")
+	if err != nil || view.String() != "peer-k" {
+		t.Fatalf("expected value from the new owner, got %q %v", view.String(), err)
+	}
+	if _, _, ok := store.Get("k"); ok || g.Stats().L2Hits != 0 {
+		t.Fatalf("expected the stale l2 copy to be dropped")
+	}
+	store.Put("m", []byte("stale"), time.Time{})
+	if values, errs := g.GetMany([]string{"m"}); errs[0] != nil || values[0].String() != "peer-m" {
+		t.Fatalf("expected value from the new owner, got %q %v", values[0].String(), errs[0])
+	}
+	if _, _, ok := store.Get("m"); ok || g.Stats().L2Hits != 0 {
+		t.Fatalf("expected the stale l2 copy to be dropped by GetMany")
+	}
+}
@@ -0,0 +1,252 @@
+package lfu
+
+import (
+	"container/list"
+	"gocache/lru"
+	"time"
+)
+
+type Value = lru.Value
+
+//
+// Cache
+// @Description: 按访问频次淘汰的缓存，频次相同时淘汰最久未访问的，所有操作均为O(1)
+//
+type Cache struct {
+	//允许使用的最大内存
+	maxBytes int64
+	//当前已使用内存
+	nbytes int64
+	//频次桶链表，按频次从小到大排列，元素为*bucket
+	buckets *list.List
+	cache   map[string]*list.Element
+	//某条记录被移除时的回调函数
+	OnEvicted func(key string, value Value)
+}
+
+//
+// bucket
+// @Description: 相同访问频次的记录，entries队首为最近访问
+//
+type bucket struct {
+	freq    int
+	entries *list.List
+}
+
+type entry struct {
+	key   string
+	value Value
+	//过期时间，零值表示永不过期
+	expire time.Time
+	//所在的频次桶
+	bucket *list.Element
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+//
+// New
+// @Description: 实例化Cache
+// @param maxBytes
+// @param OnEvicted
+// @return *Cache
+//
+func New(maxBytes int64, OnEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		buckets:   list.New(),
+		cache:     make(map[string]*list.Element),
+		OnEvicted: OnEvicted,
+	}
+}
+
+//
+// Get
+// @Description: 查找，命中的记录访问频次加一
+// @receiver c
+// @param key
+// @return value
+// @return ok
+//
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		//惰性过期，访问时发现过期直接删除
+		if kv.expired(time.Now()) {
+			c.removeElement(ele)
+			return nil, false
+		}
+		c.increment(ele)
+		return kv.value, true
+	}
+	return
+}
+
+//
+// increment
+// @Description: 将记录移入频次加一的桶，原桶为空时删除
+// @receiver c
+// @param ele
+//
+func (c *Cache) increment(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	cur := kv.bucket
+	freq := cur.Value.(*bucket).freq + 1
+	next := cur.Next()
+	if next == nil || next.Value.(*bucket).freq != freq {
+		next = c.buckets.InsertAfter(&bucket{freq: freq, entries: list.New()}, cur)
+	}
+	c.detach(ele)
+	kv.bucket = next
+	c.cache[kv.key] = next.Value.(*bucket).entries.PushFront(kv)
+}
+
+//
+// detach
+// @Description: 将记录从所在桶中移除，桶为空时一并删除
+// @receiver c
+// @param ele
+//
+func (c *Cache) detach(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	b := kv.bucket.Value.(*bucket)
+	b.entries.Remove(ele)
+	if b.entries.Len() == 0 {
+		c.buckets.Remove(kv.bucket)
+	}
+}
+
+//
+// RemoveOldest
+// @Description: 删除策略，淘汰访问频次最低的桶中最久未访问的记录
+// @receiver c
+//
+func (c *Cache) RemoveOldest() {
+	front := c.buckets.Front()
+	if front == nil {
+		return
+	}
+	c.removeElement(front.Value.(*bucket).entries.Back())
+}
+
+//
+// Add
+// @Description: 添加
+// @receiver c
+// @param key
+// @param value
+//
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+//
+// AddWithExpire
+// @Description: 添加带过期时间的缓存，expire为零值表示永不过期，更新已有记录视为一次访问
+// @receiver c
+// @param key
+// @param value
+// @param expire
+//
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
+		kv.value = value
+		kv.expire = expire
+		c.increment(ele)
+	} else {
+		//先腾出空间再插入，否则新记录频次最低会被立即淘汰
+		size := int64(len(key)) + int64(value.Len())
+		for c.maxBytes != 0 && len(c.cache) > 0 && c.maxBytes < c.nbytes+size {
+			c.RemoveOldest()
+		}
+		first := c.buckets.Front()
+		if first == nil || first.Value.(*bucket).freq != 1 {
+			first = c.buckets.PushFront(&bucket{freq: 1, entries: list.New()})
+		}
+		kv := &entry{key: key, value: value, expire: expire, bucket: first}
+		c.cache[key] = first.Value.(*bucket).entries.PushFront(kv)
+		c.nbytes += size
+	}
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+//
+// Remove
+// @Description: 删除指定key的缓存，返回是否存在
+// @receiver c
+// @param key
+// @return bool
+//
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	c.detach(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+//
+// RemoveExpired
+// @Description: 清理所有已过期的缓存，返回清理的条数
+// @receiver c
+// @return int
+//
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	removed := 0
+	for _, ele := range c.cache {
+		if ele.Value.(*entry).expired(now) {
+			c.removeElement(ele)
+			removed++
+		}
+	}
+	return removed
+}
+
+//
+// Range
+// @Description: 按淘汰顺序遍历缓存，频次低的在前，频次相同时最久未访问的在前，跳过已过期的记录，不改变访问顺序，fn返回false时停止
+// @receiver c
+// @param fn
+//
+func (c *Cache) Range(fn func(key string, value Value, expire time.Time) bool) {
+	now := time.Now()
+	for b := c.buckets.Front(); b != nil; b = b.Next() {
+		for ele := b.Value.(*bucket).entries.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			if !kv.expired(now) && !fn(kv.key, kv.value, kv.expire) {
+				return
+			}
+		}
+	}
+}
+
+//
+// Bytes
+// @Description: 当前已使用内存
+// @receiver c
+// @return int64
+//
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
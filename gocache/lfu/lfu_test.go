@@ -0,0 +1,113 @@
+package lfu
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestEvict(t *testing.T) {
+	var evicted []string
+	//每条记录占用4字节
+	lfu := New(12, func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	lfu.Add("k1", String("v1"))
+	lfu.Add("k2", String("v2"))
+	lfu.Add("k3", String("v3"))
+	lfu.Get("k1")
+	lfu.Get("k1")
+	lfu.Get("k3")
+	//k2访问频次最低
+	lfu.Add("k4", String("v4"))
+	if _, ok := lfu.Get("k2"); ok || len(evicted) != 1 || evicted[0] != "k2" {
+		t.Fatalf("expected k2 evicted, got %v", evicted)
+	}
+	//k4与k3频次相同时淘汰最久未访问的k3
+	lfu.Get("k4")
+	lfu.Add("k5", String("v5"))
+	if _, ok := lfu.Get("k3"); ok || evicted[1] != "k3" {
+		t.Fatalf("expected k3 evicted, got %v", evicted)
+	}
+	if lfu.Len() != 3 || lfu.Bytes() != 12 {
+		t.Fatalf("unexpected len %d bytes %d", lfu.Len(), lfu.Bytes())
+	}
+}
+
+func TestScan(t *testing.T) {
+	lfu := New(40, nil)
+	for i := 0; i < 5; i++ {
+		lfu.Add("hot"+strconv.Itoa(i), String("v"))
+		lfu.Get("hot" + strconv.Itoa(i))
+	}
+	//一次性扫描不会淘汰访问过多次的记录
+	for i := 0; i < 100; i++ {
+		lfu.Add("scan"+strconv.Itoa(i), String("v"))
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := lfu.Get("hot" + strconv.Itoa(i)); !ok {
+			t.Fatalf("hot key %d evicted by scan", i)
+		}
+	}
+}
+
+func TestRemove(t *testing.T) {
+	evicted := make([]string, 0)
+	lfu := New(0, func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	lfu.Add("key1", String("1234"))
+	lfu.Add("key2", String("5678"))
+	lfu.Add("key2", String("56"))
+	if !lfu.Remove("key1") || lfu.Remove("key1") {
+		t.Fatalf("remove should report existence")
+	}
+	if lfu.Len() != 1 || lfu.Bytes() != int64(len("key2")+len("56")) {
+		t.Fatalf("unexpected len %d bytes %d", lfu.Len(), lfu.Bytes())
+	}
+	if len(evicted) != 1 || evicted[0] != "key1" {
+		t.Fatalf("OnEvicted not called, got %v", evicted)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	lfu := New(0, nil)
+	lfu.AddWithExpire("key1", String("1234"), time.Now().Add(-time.Second))
+	lfu.AddWithExpire("key2", String("5678"), time.Now().Add(time.Hour))
+	lfu.Add("key3", String("9"))
+	if _, ok := lfu.Get("key1"); ok || lfu.Len() != 2 {
+		t.Fatalf("expired key1 should be removed lazily")
+	}
+	lfu.AddWithExpire("key2", String("5678"), time.Now().Add(-time.Second))
+	if n := lfu.RemoveExpired(); n != 1 || lfu.Len() != 1 {
+		t.Fatalf("expected 1 expired entry removed, got %d", n)
+	}
+	if _, ok := lfu.Get("key3"); !ok {
+		t.Fatalf("key3 should never expire")
+	}
+}
+
+func TestRange(t *testing.T) {
+	lfu := New(0, nil)
+	lfu.Add("k1", String("v1"))
+	lfu.Add("k2", String("v2"))
+	lfu.Add("k3", String("v3"))
+	lfu.Get("k1")
+	lfu.Get("k1")
+	lfu.Get("k3")
+	var keys []string
+	lfu.Range(func(key string, value Value, expire time.Time) bool {
+		keys = append(keys, key)
+		return true
+	})
+	//按淘汰顺序，频次低的在前
+	if len(keys) != 3 || keys[0] != "k2" || keys[1] != "k3" || keys[2] != "k1" {
+		t.Fatalf("expected keys in eviction order, got %v", keys)
+	}
+}
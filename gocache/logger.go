@@ -0,0 +1,133 @@
+package gocache
+
+import (
+	"fmt"
+	"gocache/internal/fnv1a"
+	"log"
+	"strings"
+)
+
+//
+// Level
+// @Description: 日志级别，取值与log/slog一致
+//
+type Level int
+
+const (
+	//每次请求都会产生的日志，默认不输出
+	LevelDebug Level = -4
+	//节点变更、交接等低频事件
+	LevelInfo Level = 0
+	//远程节点或二级缓存出错，请求仍可降级完成
+	LevelWarn  Level = 4
+	LevelError Level = 8
+)
+
+func (l Level) String() string {
+	switch {
+	case l < LevelInfo:
+		return "DEBUG"
+	case l < LevelWarn:
+		return "INFO"
+	case l < LevelError:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+//
+// Field
+// @Description: 结构化日志的字段
+//
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+//
+// Logger
+// @Description: 可替换的分级日志接口，实现需并发安全。热点路径上先调用Enabled判断，未开启时不构造字段
+//
+type Logger interface {
+	Enabled(level Level) bool
+	Log(level Level, msg string, fields ...Field)
+}
+
+var (
+	//默认输出Info及以上级别，请求级别的Debug日志不输出
+	defaultLogger = NewStdLogger(nil, LevelInfo)
+	//丢弃全部日志
+	NopLogger Logger = nopLogger{}
+)
+
+type nopLogger struct{}
+
+func (nopLogger) Enabled(Level) bool { return false }
+
+func (nopLogger) Log(Level, string, ...Field) {}
+
+//
+// stdLogger
+// @Description: 基于标准库log的Logger，字段以key=value的形式追加在消息之后
+//
+type stdLogger struct {
+	l     *log.Logger
+	level Level
+}
+
+//
+// NewStdLogger
+// @Description: 使用标准库log输出level及以上级别的日志
+// @param l 为nil时使用log包的默认Logger
+// @param level
+// @return Logger
+//
+func NewStdLogger(l *log.Logger, level Level) Logger {
+	if l == nil {
+		l = log.Default()
+	}
+	return &stdLogger{l: l, level: level}
+}
+
+func (s *stdLogger) Enabled(level Level) bool {
+	return level >= s.level
+}
+
+func (s *stdLogger) Log(level Level, msg string, fields ...Field) {
+	if !s.Enabled(level) {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[gocache] %s %s", level, msg)
+	for _, f := range fields {
+		fmt.Fprintf(&b, " %s=%v", f.Key, f.Value)
+	}
+	s.l.Print(b.String())
+}
+
+//
+// keyHashField
+// @Description: 以key的哈希值代替key本身，避免日志中出现业务数据且长度固定
+// @param key
+// @return Field
+//
+func keyHashField(key string) Field {
+	return Field{"key_hash", fmt.Sprintf("%08x", fnv1a.Sum32(key))}
+}
+
+//
+// logKey
+// @Description: 输出与key相关的日志，附带group与key_hash字段，未开启该级别时直接返回
+// @receiver g
+// @param level
+// @param msg
+// @param key
+// @param fields
+//
+func (g *Group) logKey(level Level, msg, key string, fields ...Field) {
+	if !g.logger.Enabled(level) {
+		return
+	}
+	g.logger.Log(level, msg, append([]Field{{"group", g.name}, keyHashField(key)}, fields...)...)
+}
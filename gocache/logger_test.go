@@ -0,0 +1,117 @@
+package gocache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	pb "gocache/gocachepb"
+	"gocache/internal/fnv1a"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+)
+
+type logEntry struct {
+	level  Level
+	msg    string
+	fields map[string]interface{}
+}
+
+type recordLogger struct {
+	level   Level
+	mu      sync.Mutex
+	entries []logEntry
+}
+
+func (l *recordLogger) Enabled(level Level) bool {
+	return level >= l.level
+}
+
+func (l *recordLogger) Log(level Level, msg string, fields ...Field) {
+	e := logEntry{level: level, msg: msg, fields: make(map[string]interface{})}
+	for _, f := range fields {
+		e.fields[f.Key] = f.Value
+	}
+	l.mu.Lock()
+	l.entries = append(l.entries, e)
+	l.mu.Unlock()
+}
+
+func (l *recordLogger) find(msg string) (logEntry, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, e := range l.entries {
+		if e.msg == msg {
+			return e, true
+		}
+	}
+	return logEntry{}, false
+}
+
+type downPeer struct {
+	PeerGetter
+}
+
+func (downPeer) Get(context.Context, *pb.Request, *pb.Response) error {
+	return fmt.Errorf("peer down")
+}
+
+func (downPeer) String() string {
+	return "down"
+}
+
+func TestGroupLogger(t *testing.T) {
+	getter := GetterFunc(func(key string) ([]byte, error) {
+		return []byte("db-" + key), nil
+	})
+	//默认级别下命中与加载不输出日志
+	quiet := &recordLogger{level: LevelInfo}
+	g := NewGroup("logger-quiet", 2<<10, getter, WithLogger(quiet))
+	g.Get("k")
+	g.Get("k")
+	if len(quiet.entries) != 0 {
+		t.Fatalf("expected no logs on the hot path, got %v", quiet.entries)
+	}
+
+	verbose := &recordLogger{level: LevelDebug}
+	g = NewGroup("logger-verbose", 2<<10, getter, WithLogger(verbose))
+	g.RegisterPeers(fakeReplicas{downPeer{}, nil})
+	g.Get("secret")
+	g.Get("secret")
+	failed, ok := verbose.find("failed to load from peer")
+	if !ok || failed.level != LevelWarn {
+		t.Fatalf("expected a warning for the failed peer, got %v", verbose.entries)
+	}
+	if failed.fields["peer"] != (downPeer{}) || failed.fields["latency"] == nil || failed.fields["err"] == nil {
+		t.Fatalf("unexpected fields %v", failed.fields)
+	}
+	hit, ok := verbose.find("cache hit")
+	if !ok || hit.fields["group"] != "logger-verbose" {
+		t.Fatalf("expected a debug log for the cache hit, got %v", verbose.entries)
+	}
+	//日志中只出现key的哈希值
+	if hit.fields["key_hash"] != fmt.Sprintf("%08x", fnv1a.Sum32("secret")) {
+		t.Fatalf("unexpected key hash %v", hit.fields["key_hash"])
+	}
+	for _, e := range verbose.entries {
+		for _, v := range e.fields {
+			if v == "secret" {
+				t.Fatalf("raw key leaked into %q", e.msg)
+			}
+		}
+	}
+}
+
+func TestStdLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewStdLogger(log.New(&buf, "", 0), LevelInfo)
+	l.Log(LevelDebug, "dropped")
+	l.Log(LevelWarn, "peer failed", Field{"peer", "a"}, Field{"attempt", 2})
+	if got := strings.TrimSpace(buf.String()); got != "[gocache] WARN peer failed peer=a attempt=2" {
+		t.Fatalf("unexpected output %q", got)
+	}
+	if NopLogger.Enabled(LevelError) {
+		t.Fatalf("expected NopLogger to be disabled")
+	}
+}
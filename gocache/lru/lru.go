@@ -1,6 +1,9 @@
 package lru
 
-import "container/list"
+import (
+	"container/list"
+	"time"
+)
 
 type Cache struct {
 	//允许使用的最大内存
@@ -16,6 +19,12 @@ type Cache struct {
 type entry struct {
 	key   string
 	value Value
+	//过期时间，零值表示永不过期
+	expire time.Time
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
 }
 
 type Value interface {
@@ -48,8 +57,13 @@ func New(maxBytes int64, OnEvicted func(string, Value)) *Cache {
 //
 func (c *Cache) Get(key string) (value Value, ok bool) {
 	if ele, ok := c.cache[key]; ok {
-		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
+		//惰性过期，访问时发现过期直接删除
+		if kv.expired(time.Now()) {
+			c.removeElement(ele)
+			return nil, false
+		}
+		c.ll.MoveToFront(ele)
 		return kv.value, true
 	}
 	return
@@ -63,10 +77,7 @@ func (c *Cache) Get(key string) (value Value, ok bool) {
 func (c *Cache) RemoveOldest() {
 	ele := c.ll.Back()
 	if ele != nil {
-		c.ll.Remove(ele)
-		kv := ele.Value.(*entry)
-		delete(c.cache, kv.key)
-		c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+		c.removeElement(ele)
 	}
 }
 
@@ -78,13 +89,26 @@ func (c *Cache) RemoveOldest() {
 // @param value
 //
 func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+//
+// AddWithExpire
+// @Description: 添加带过期时间的缓存，expire为零值表示永不过期
+// @receiver c
+// @param key
+// @param value
+// @param expire
+//
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
 	if ele, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ele)
 		kv := ele.Value.(*entry)
 		c.nbytes += int64(value.Len()) - int64(kv.value.Len())
 		kv.value = value
+		kv.expire = expire
 	} else {
-		ele := c.ll.PushFront(&entry{key, value})
+		ele := c.ll.PushFront(&entry{key: key, value: value, expire: expire})
 		c.cache[key] = ele
 		c.nbytes += int64(len(key)) + int64(value.Len())
 	}
@@ -93,6 +117,77 @@ func (c *Cache) Add(key string, value Value) {
 	}
 }
 
+//
+// Remove
+// @Description: 删除指定key的缓存，返回是否存在
+// @receiver c
+// @param key
+// @return bool
+//
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	c.ll.Remove(ele)
+	kv := ele.Value.(*entry)
+	delete(c.cache, kv.key)
+	c.nbytes -= int64(len(kv.key)) + int64(kv.value.Len())
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+//
+// RemoveExpired
+// @Description: 清理所有已过期的缓存，返回清理的条数
+// @receiver c
+// @return int
+//
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	removed := 0
+	for ele := c.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		if ele.Value.(*entry).expired(now) {
+			c.removeElement(ele)
+			removed++
+		}
+		ele = prev
+	}
+	return removed
+}
+
+//
+// Range
+// @Description: 从最久未访问到最近访问遍历缓存，跳过已过期的记录，不改变访问顺序，fn返回false时停止
+// @receiver c
+// @param fn
+//
+func (c *Cache) Range(fn func(key string, value Value, expire time.Time) bool) {
+	now := time.Now()
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+		kv := ele.Value.(*entry)
+		if !kv.expired(now) && !fn(kv.key, kv.value, kv.expire) {
+			return
+		}
+	}
+}
+
+//
+// Bytes
+// @Description: 当前已使用内存
+// @receiver c
+// @return int64
+//
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
 func (c *Cache) Len() int {
 	return c.ll.Len()
 }
@@ -1,3 +1,78 @@
 package lru
 
+import (
+	"testing"
+	"time"
+)
+
 type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestRemove(t *testing.T) {
+	evicted := make([]string, 0)
+	lru := New(0, func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	lru.Add("key1", String("1234"))
+	lru.Add("key2", String("5678"))
+	if !lru.Remove("key1") {
+		t.Fatalf("remove key1 failed")
+	}
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 1 {
+		t.Fatalf("key1 should be removed")
+	}
+	if lru.Remove("key1") {
+		t.Fatalf("remove missing key should return false")
+	}
+	if lru.nbytes != int64(len("key2")+len("5678")) {
+		t.Fatalf("unexpected nbytes %d", lru.nbytes)
+	}
+	if len(evicted) != 1 || evicted[0] != "key1" {
+		t.Fatalf("OnEvicted not called, got %v", evicted)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	lru := New(0, nil)
+	lru.AddWithExpire("key1", String("1234"), time.Now().Add(-time.Second))
+	lru.AddWithExpire("key2", String("5678"), time.Now().Add(time.Hour))
+	lru.Add("key3", String("9"))
+	if _, ok := lru.Get("key1"); ok || lru.Len() != 2 {
+		t.Fatalf("expired key1 should be removed lazily")
+	}
+	lru.AddWithExpire("key2", String("5678"), time.Now().Add(-time.Second))
+	if n := lru.RemoveExpired(); n != 1 || lru.Len() != 1 {
+		t.Fatalf("expected 1 expired entry removed, got %d", n)
+	}
+	if _, ok := lru.Get("key3"); !ok {
+		t.Fatalf("key3 should never expire")
+	}
+}
+
+func TestRange(t *testing.T) {
+	lru := New(0, nil)
+	lru.Add("key1", String("1"))
+	lru.Add("key2", String("2"))
+	lru.AddWithExpire("expired", String("3"), time.Now().Add(-time.Second))
+	lru.Add("key3", String("4"))
+	lru.Get("key1")
+	var keys []string
+	lru.Range(func(key string, value Value, expire time.Time) bool {
+		keys = append(keys, key)
+		return true
+	})
+	if len(keys) != 3 || keys[0] != "key2" || keys[1] != "key3" || keys[2] != "key1" {
+		t.Fatalf("expected keys from least to most recently used, got %v", keys)
+	}
+	//遍历不改变访问顺序
+	lru.Range(func(key string, value Value, expire time.Time) bool {
+		return false
+	})
+	lru.RemoveOldest()
+	if _, ok := lru.Get("key2"); ok {
+		t.Fatalf("range should not change recency")
+	}
+}
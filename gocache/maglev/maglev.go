@@ -0,0 +1,137 @@
+package maglev
+
+import (
+	"gocache/internal/fnv1a"
+	"sort"
+)
+
+const (
+	//查找表大小，须为质数且远大于节点数，表越大分布越均匀
+	defaultTableSize = 65537
+)
+
+//
+// Map
+// @Description: Maglev哈希，每个节点按各自的偏移量与步长生成表项排列，轮流填充固定大小的查找表，
+// 查找只需一次取模，各节点分得的表项数最多相差1。节点变更时重建查找表，少量key会在其余节点间移动
+//
+type Map struct {
+	//查找表大小
+	size uint64
+	//按名称排序的节点，保证各进程生成相同的查找表
+	nodes []string
+	//表项对应nodes的下标，无节点时为空
+	table []int
+}
+
+//
+// New
+// @Description: 实例化Map，size不为质数时表项排列会重复，size小于2时使用默认大小
+// @param size
+// @return *Map
+//
+func New(size int) *Map {
+	if size < 2 {
+		size = defaultTableSize
+	}
+	return &Map{size: uint64(size)}
+}
+
+//
+// Add
+// @Description: 添加节点并重建查找表，已存在的节点会被忽略
+// @receiver m
+// @param keys
+//
+func (m *Map) Add(keys ...string) {
+	for _, key := range keys {
+		i := sort.SearchStrings(m.nodes, key)
+		if i < len(m.nodes) && m.nodes[i] == key {
+			continue
+		}
+		m.nodes = append(m.nodes, "")
+		copy(m.nodes[i+1:], m.nodes[i:])
+		m.nodes[i] = key
+	}
+	m.populate()
+}
+
+//
+// Remove
+// @Description: 删除节点并重建查找表
+// @receiver m
+// @param keys
+//
+func (m *Map) Remove(keys ...string) {
+	for _, key := range keys {
+		i := sort.SearchStrings(m.nodes, key)
+		if i < len(m.nodes) && m.nodes[i] == key {
+			m.nodes = append(m.nodes[:i], m.nodes[i+1:]...)
+		}
+	}
+	m.populate()
+}
+
+//
+// populate
+// @Description: 各节点轮流按自己的排列(offset+j*skip)%size选取第一个空闲表项，直至填满查找表
+// @receiver m
+//
+func (m *Map) populate() {
+	if len(m.nodes) == 0 {
+		m.table = nil
+		return
+	}
+	offsets := make([]uint64, len(m.nodes))
+	skips := make([]uint64, len(m.nodes))
+	for i, node := range m.nodes {
+		offsets[i] = fnv1a.Mix64(fnv1a.Sum64Seed(node, 0)) % m.size
+		skips[i] = fnv1a.Mix64(fnv1a.Sum64Seed(node, 1))%(m.size-1) + 1
+	}
+	table := make([]int, m.size)
+	for i := range table {
+		table[i] = -1
+	}
+	//每个节点在自己的排列中下一个待尝试的位置
+	next := make([]uint64, len(m.nodes))
+	for filled := uint64(0); ; {
+		for i := range m.nodes {
+			c := (offsets[i] + next[i]*skips[i]) % m.size
+			for table[c] >= 0 {
+				next[i]++
+				c = (offsets[i] + next[i]*skips[i]) % m.size
+			}
+			table[c] = i
+			next[i]++
+			filled++
+			if filled == m.size {
+				m.table = table
+				return
+			}
+		}
+	}
+}
+
+//
+// Get
+// @Description: 查找表中key对应表项的节点
+// @receiver m
+// @param key
+// @return string
+//
+func (m *Map) Get(key string) string {
+	if len(key) == 0 || m.IsEmpty() {
+		return ""
+	}
+	return m.nodes[m.table[fnv1a.Mix64(fnv1a.Sum64(key))%m.size]]
+}
+
+//
+// IsEmpty
+// @Description: 是否没有节点
+// @receiver m
+// @return bool
+//
+func (m *Map) IsEmpty() bool {
+	return len(m.nodes) == 0
+}
@@ -0,0 +1,109 @@
+package maglev
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func owners(m *Map, n int) []string {
+	owners := make([]string, n)
+	for i := range owners {
+		owners[i] = m.Get(strconv.Itoa(i))
+	}
+	return owners
+}
+
+func TestPopulate(t *testing.T) {
+	m := New(7)
+	if m.Get("k") != "" {
+		t.Fatalf("expected empty map to return no node")
+	}
+	m.Add("a", "b", "c")
+	//各节点分得的表项数最多相差1
+	counts := make(map[int]int)
+	for _, i := range m.table {
+		counts[i]++
+	}
+	for i, c := range counts {
+		if c < 2 || c > 3 {
+			t.Fatalf("node %s owns %d of 7 entries: %v", m.nodes[i], c, m.table)
+		}
+	}
+	//节点加入顺序不影响查找表
+	other := New(7)
+	other.Add("c", "b")
+	other.Add("a")
+	for i := range m.table {
+		if m.nodes[m.table[i]] != other.nodes[other.table[i]] {
+			t.Fatalf("tables differ at %d", i)
+		}
+	}
+	m.Remove("a", "b", "c")
+	if !m.IsEmpty() || m.Get("k") != "" {
+		t.Fatalf("expected empty map after removing all nodes")
+	}
+}
+
+func TestMovement(t *testing.T) {
+	const keys = 100000
+	m := New(0)
+	for i := 0; i < 10; i++ {
+		m.Add("node" + strconv.Itoa(i))
+	}
+	before := owners(m, keys)
+
+	//重建查找表时少量key会在原有节点间移动
+	m.Add("node10")
+	moved, toNew := 0, 0
+	for i, owner := range owners(m, keys) {
+		if owner != before[i] {
+			moved++
+			if owner == "node10" {
+				toNew++
+			}
+		}
+	}
+	if ratio := float64(toNew) / keys; math.Abs(ratio-1.0/11) > 0.01 {
+		t.Fatalf("expected about 1/11 keys to move to the new node, got %.4f", ratio)
+	}
+	if ratio := float64(moved) / keys; ratio > 1.5/11 {
+		t.Fatalf("too many keys moved on add: %.4f", ratio)
+	}
+
+	before = owners(m, keys)
+	m.Remove("node3")
+	moved = 0
+	for i, owner := range owners(m, keys) {
+		if owner == "node3" {
+			t.Fatalf("key %d still owned by removed node", i)
+		}
+		if owner != before[i] {
+			moved++
+		}
+	}
+	if ratio := float64(moved) / keys; ratio > 1.5/11 {
+		t.Fatalf("too many keys moved on remove: %.4f", ratio)
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	const keys = 100000
+	m := New(0)
+	for i := 0; i < 10; i++ {
+		m.Add("node" + strconv.Itoa(i))
+	}
+	counts := make(map[string]int)
+	for _, owner := range owners(m, keys) {
+		counts[owner]++
+	}
+	var sum, sq float64
+	for _, c := range counts {
+		sum += float64(c)
+		sq += float64(c) * float64(c)
+	}
+	mean := sum / 10
+	if cv := math.Sqrt(sq/10-mean*mean) / mean; len(counts) != 10 || cv > 0.05 {
+		t.Fatalf("coefficient of variation %.4f too high: %v", cv, counts)
+	}
+}
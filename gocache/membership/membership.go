@@ -0,0 +1,710 @@
+package membership
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gocache"
+	"math/rand"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+//
+// State
+// @Description: 成员状态，Suspect的成员仍被视为存活，直至怀疑超时后才判定为Dead
+//
+type State int
+
+const (
+	Alive State = iota
+	Suspect
+	Dead
+)
+
+func (s State) String() string {
+	switch s {
+	case Alive:
+		return "alive"
+	case Suspect:
+		return "suspect"
+	case Dead:
+		return "dead"
+	}
+	return "unknown"
+}
+
+//
+// Member
+// @Description: 集群中的一个成员
+//
+type Member struct {
+	//成员名，即对外提供缓存服务的地址，全局唯一
+	Name string `json:"name"`
+	//成员间交换心跳的udp地址
+	Addr  string `json:"addr"`
+	State State  `json:"state"`
+	//版本号，只有节点自身可以递增，用于反驳其余节点对它的怀疑
+	Incarnation uint64 `json:"incarnation"`
+}
+
+//
+// Config
+// @Description: 成员管理配置
+//
+type Config struct {
+	//本节点成员名
+	Name string
+	//本节点监听的udp地址，端口为0时随机选取
+	BindAddr string
+	//每隔多久探测一个成员
+	ProbeInterval time.Duration
+	//等待直接探测应答的时间，超时后委托其余成员间接探测
+	ProbeTimeout time.Duration
+	//间接探测时委托的成员数
+	IndirectProbes int
+	//被怀疑的成员在该时长内未能反驳则判定为Dead
+	SuspectTimeout time.Duration
+	//Dead成员在表中保留的时长，之后被清除
+	DeadReclaim time.Duration
+	//被清除的成员保留版本号的时长，期间收到的旧状态不会使其复活
+	TombstoneTimeout time.Duration
+	//存活成员集合变化时回调，joined与left均为成员名
+	OnChange func(joined, left []string)
+	//输出收包出错等日志，默认使用标准库log输出Info及以上级别
+	Logger gocache.Logger
+}
+
+const (
+	defaultProbeInterval  = time.Second
+	defaultProbeTimeout   = 300 * time.Millisecond
+	defaultIndirectProbes = 3
+	defaultSuspectTimeout = 5 * time.Second
+	defaultDeadReclaim    = time.Minute
+	defaultTombstoneTTL   = 5 * time.Minute
+	maxPacketSize         = 64 * 1024
+	//读取出错时的退避时长范围
+	minReadBackoff = 5 * time.Millisecond
+	maxReadBackoff = time.Second
+)
+
+type msgType int
+
+const (
+	msgPing msgType = iota
+	msgAck
+	msgPingReq
+)
+
+//
+// message
+// @Description: 成员之间交换的消息，每条消息都捎带发送方的成员表用于传播状态
+//
+type message struct {
+	Type msgType `json:"type"`
+	Seq  uint64  `json:"seq"`
+	From string  `json:"from"`
+	//间接探测的目标udp地址
+	Target  string   `json:"target,omitempty"`
+	Members []Member `json:"members,omitempty"`
+}
+
+type memberState struct {
+	Member
+	//进入当前状态的时间
+	since time.Time
+}
+
+//
+// Memberlist
+// @Description: 基于SWIM协议的成员管理，通过udp探测发现故障成员并以gossip方式传播成员状态
+//
+type Memberlist struct {
+	cfg  Config
+	conn *net.UDPConn
+
+	mu      sync.Mutex
+	members map[string]*memberState
+	//已清除成员的最后状态，记录其版本号直至TombstoneTimeout
+	tombstones map[string]*memberState
+	//探测顺序，每轮结束后重新打乱
+	probeOrder []string
+	probeIndex int
+
+	ackMu    sync.Mutex
+	seq      uint64
+	ackChans map[uint64]chan struct{}
+
+	notifyMu sync.Mutex
+	lastLive map[string]bool
+
+	done     chan struct{}
+	stopOnce sync.Once
+	wg       sync.WaitGroup
+}
+
+//
+// New
+// @Description: 创建成员管理并开始监听与探测，此时集群中只有本节点
+// @param cfg
+// @return *Memberlist
+// @return error
+//
+func New(cfg Config) (*Memberlist, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("membership: requires name")
+	}
+	if cfg.ProbeInterval <= 0 {
+		cfg.ProbeInterval = defaultProbeInterval
+	}
+	if cfg.ProbeTimeout <= 0 {
+		cfg.ProbeTimeout = defaultProbeTimeout
+	}
+	if cfg.IndirectProbes <= 0 {
+		cfg.IndirectProbes = defaultIndirectProbes
+	}
+	if cfg.SuspectTimeout <= 0 {
+		cfg.SuspectTimeout = defaultSuspectTimeout
+	}
+	if cfg.DeadReclaim <= 0 {
+		cfg.DeadReclaim = defaultDeadReclaim
+	}
+	if cfg.TombstoneTimeout <= 0 {
+		cfg.TombstoneTimeout = defaultTombstoneTTL
+	}
+	if cfg.Logger == nil {
+		cfg.Logger = gocache.NewStdLogger(nil, gocache.LevelInfo)
+	}
+	udpAddr, err := net.ResolveUDPAddr("udp", cfg.BindAddr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", udpAddr)
+	if err != nil {
+		return nil, err
+	}
+	m := &Memberlist{
+		cfg:        cfg,
+		conn:       conn,
+		members:    make(map[string]*memberState),
+		tombstones: make(map[string]*memberState),
+		ackChans:   make(map[uint64]chan struct{}),
+		lastLive:   make(map[string]bool),
+		done:       make(chan struct{}),
+	}
+	//以启动时间作为初始版本号，重启后的节点天然高于旧的状态
+	m.members[cfg.Name] = &memberState{
+		Member: Member{
+			Name:        cfg.Name,
+			Addr:        conn.LocalAddr().String(),
+			State:       Alive,
+			Incarnation: uint64(time.Now().UnixNano()),
+		},
+		since: time.Now(),
+	}
+	m.wg.Add(2)
+	go m.receiveLoop()
+	go m.probeLoop()
+	m.notify()
+	return m, nil
+}
+
+//
+// Addr
+// @Description: 本节点实际监听的udp地址
+// @receiver m
+// @return string
+//
+func (m *Memberlist) Addr() string {
+	return m.conn.LocalAddr().String()
+}
+
+//
+// Join
+// @Description: 通过种子节点加入集群，至少一个种子应答即视为成功
+// @receiver m
+// @param seeds 种子节点的udp地址
+// @return error
+//
+func (m *Memberlist) Join(seeds ...string) error {
+	var lastErr error
+	joined := 0
+	for _, seed := range seeds {
+		if err := m.ping(seed, m.cfg.ProbeTimeout*3); err != nil {
+			lastErr = fmt.Errorf("join %s: %v", seed, err)
+			continue
+		}
+		joined++
+	}
+	if joined == 0 && lastErr != nil {
+		return lastErr
+	}
+	return nil
+}
+
+//
+// Members
+// @Description: 返回成员表快照，按成员名排序
+// @receiver m
+// @return []Member
+//
+func (m *Memberlist) Members() []Member {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	members := make([]Member, 0, len(m.members))
+	for _, ms := range m.members {
+		members = append(members, ms.Member)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].Name < members[j].Name
+	})
+	return members
+}
+
+//
+// Live
+// @Description: 返回存活（Alive或Suspect）成员名，按成员名排序
+// @receiver m
+// @return []string
+//
+func (m *Memberlist) Live() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.liveLocked()
+}
+
+func (m *Memberlist) liveLocked() []string {
+	var live []string
+	for name, ms := range m.members {
+		if ms.State != Dead {
+			live = append(live, name)
+		}
+	}
+	sort.Strings(live)
+	return live
+}
+
+//
+// Leave
+// @Description: 主动离开集群，先向其余成员宣告自身下线再关闭
+// @receiver m
+// @return error
+//
+func (m *Memberlist) Leave() error {
+	m.mu.Lock()
+	self := m.members[m.cfg.Name]
+	self.Incarnation++
+	self.State = Dead
+	//借用不对应任何探测的ack消息，仅用于传播自身的下线状态
+	msg := message{Type: msgAck, From: m.cfg.Name, Members: []Member{self.Member}}
+	var addrs []string
+	for name, ms := range m.members {
+		if name != m.cfg.Name && ms.State != Dead {
+			addrs = append(addrs, ms.Addr)
+		}
+	}
+	m.mu.Unlock()
+	for _, addr := range addrs {
+		m.send(addr, msg)
+	}
+	return m.Close()
+}
+
+//
+// Close
+// @Description: 直接停止收发，其余成员将通过探测发现本节点故障
+// @receiver m
+// @return error
+//
+func (m *Memberlist) Close() error {
+	var err error
+	m.stopOnce.Do(func() {
+		close(m.done)
+		err = m.conn.Close()
+		m.wg.Wait()
+	})
+	return err
+}
+
+func (m *Memberlist) receiveLoop() {
+	defer m.wg.Done()
+	buf := make([]byte, maxPacketSize)
+	var backoff time.Duration
+	for {
+		n, from, err := m.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			//其余错误可能持续出现，退避后重试避免空转
+			if backoff *= 2; backoff < minReadBackoff {
+				backoff = minReadBackoff
+			} else if backoff > maxReadBackoff {
+				backoff = maxReadBackoff
+			}
+			m.cfg.Logger.Log(gocache.LevelWarn, "membership read failed",
+				gocache.Field{Key: "name", Value: m.cfg.Name}, gocache.Field{Key: "retry_in", Value: backoff}, gocache.Field{Key: "err", Value: err})
+			select {
+			case <-m.done:
+				return
+			case <-time.After(backoff):
+			}
+			continue
+		}
+		backoff = 0
+		var msg message
+		if err := json.Unmarshal(buf[:n], &msg); err != nil {
+			m.cfg.Logger.Log(gocache.LevelWarn, "membership bad packet",
+				gocache.Field{Key: "name", Value: m.cfg.Name}, gocache.Field{Key: "from", Value: from}, gocache.Field{Key: "err", Value: err})
+			continue
+		}
+		m.handle(from.String(), msg)
+	}
+}
+
+//
+// handle
+// @Description: 处理收到的消息，先合并捎带的成员表，再按消息类型应答
+// @receiver m
+// @param from
+// @param msg
+//
+func (m *Memberlist) handle(from string, msg message) {
+	m.merge(msg.Members)
+	switch msg.Type {
+	case msgPing:
+		m.send(from, message{Type: msgAck, Seq: msg.Seq, From: m.cfg.Name, Members: m.Members()})
+	case msgAck:
+		m.ackMu.Lock()
+		ch, ok := m.ackChans[msg.Seq]
+		if ok {
+			delete(m.ackChans, msg.Seq)
+		}
+		m.ackMu.Unlock()
+		if ok {
+			close(ch)
+		}
+	case msgPingReq:
+		//代替请求方探测目标，目标应答后转告请求方
+		go func() {
+			if m.ping(msg.Target, m.cfg.ProbeTimeout) == nil {
+				m.send(from, message{Type: msgAck, Seq: msg.Seq, From: m.cfg.Name, Members: m.Members()})
+			}
+		}()
+	}
+}
+
+//
+// merge
+// @Description: 按SWIM的规则合并成员状态，版本号高者优先，同版本下Dead>Suspect>Alive
+// @receiver m
+// @param members
+//
+func (m *Memberlist) merge(members []Member) {
+	if len(members) == 0 {
+		return
+	}
+	changed := false
+	//新进入Suspect的成员，无论由本节点探测发现还是从其余成员得知，都在本节点开始计时
+	var suspected []Member
+	m.mu.Lock()
+	for _, in := range members {
+		if in.Name == m.cfg.Name {
+			//有成员怀疑自身时递增版本号以反驳
+			self := m.members[m.cfg.Name]
+			if in.State != Alive && in.Incarnation >= self.Incarnation && self.State == Alive {
+				self.Incarnation = in.Incarnation + 1
+			}
+			continue
+		}
+		cur, ok := m.members[in.Name]
+		if !ok {
+			if in.State == Dead {
+				continue
+			}
+			//已清除的成员只接受更高的版本号，即重启或重新加入后的状态
+			if tomb, ok := m.tombstones[in.Name]; ok {
+				if in.Incarnation <= tomb.Incarnation {
+					continue
+				}
+				delete(m.tombstones, in.Name)
+			}
+			m.members[in.Name] = &memberState{Member: in, since: time.Now()}
+			if in.State == Suspect {
+				suspected = append(suspected, in)
+			}
+			changed = true
+			continue
+		}
+		if in.Incarnation < cur.Incarnation ||
+			(in.Incarnation == cur.Incarnation && in.State <= cur.State) {
+			continue
+		}
+		if in.State != cur.State {
+			changed = true
+			cur.since = time.Now()
+		}
+		if in.State == Suspect && (cur.State != Suspect || in.Incarnation != cur.Incarnation) {
+			suspected = append(suspected, in)
+		}
+		cur.Member = in
+	}
+	m.mu.Unlock()
+	for _, member := range suspected {
+		m.startSuspicion(member.Name, member.Incarnation)
+	}
+	if changed {
+		m.notify()
+	}
+}
+
+//
+// notify
+// @Description: 存活成员集合变化时回调OnChange，通过notifyMu保证回调按顺序执行
+// @receiver m
+//
+func (m *Memberlist) notify() {
+	m.notifyMu.Lock()
+	defer m.notifyMu.Unlock()
+	live := m.Live()
+	var joined, left []string
+	current := make(map[string]bool, len(live))
+	for _, name := range live {
+		current[name] = true
+		if !m.lastLive[name] {
+			joined = append(joined, name)
+		}
+	}
+	for name := range m.lastLive {
+		if !current[name] {
+			left = append(left, name)
+		}
+	}
+	m.lastLive = current
+	if (len(joined) > 0 || len(left) > 0) && m.cfg.OnChange != nil {
+		sort.Strings(left)
+		m.cfg.OnChange(joined, left)
+	}
+}
+
+func (m *Memberlist) probeLoop() {
+	defer m.wg.Done()
+	ticker := time.NewTicker(m.cfg.ProbeInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-m.done:
+			return
+		case <-ticker.C:
+			m.probe()
+			m.reap()
+		}
+	}
+}
+
+//
+// probe
+// @Description: 探测下一个成员，直接探测失败后委托其余成员间接探测，仍失败则将其标记为Suspect
+// @receiver m
+//
+func (m *Memberlist) probe() {
+	target, ok := m.nextTarget()
+	if !ok {
+		return
+	}
+	if m.ping(target.Addr, m.cfg.ProbeTimeout) == nil {
+		return
+	}
+	seq, ch := m.registerAck()
+	for _, addr := range m.randomPeers(m.cfg.IndirectProbes, target.Name) {
+		m.send(addr, message{Type: msgPingReq, Seq: seq, From: m.cfg.Name, Target: target.Addr, Members: m.Members()})
+	}
+	wait := m.cfg.ProbeInterval - m.cfg.ProbeTimeout
+	if wait < m.cfg.ProbeTimeout {
+		wait = m.cfg.ProbeTimeout
+	}
+	select {
+	case <-ch:
+		return
+	case <-time.After(wait):
+		m.cancelAck(seq)
+	case <-m.done:
+		return
+	}
+	m.suspect(target.Name, target.Incarnation)
+}
+
+func (m *Memberlist) nextTarget() (Member, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := 0; i < 2; i++ {
+		for m.probeIndex < len(m.probeOrder) {
+			name := m.probeOrder[m.probeIndex]
+			m.probeIndex++
+			if ms, ok := m.members[name]; ok && ms.State != Dead {
+				return ms.Member, true
+			}
+		}
+		//一轮结束，重新打乱探测顺序
+		m.probeOrder = m.probeOrder[:0]
+		for name, ms := range m.members {
+			if name != m.cfg.Name && ms.State != Dead {
+				m.probeOrder = append(m.probeOrder, name)
+			}
+		}
+		rand.Shuffle(len(m.probeOrder), func(i, j int) {
+			m.probeOrder[i], m.probeOrder[j] = m.probeOrder[j], m.probeOrder[i]
+		})
+		m.probeIndex = 0
+	}
+	return Member{}, false
+}
+
+func (m *Memberlist) randomPeers(k int, exclude string) []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var addrs []string
+	for name, ms := range m.members {
+		if name != m.cfg.Name && name != exclude && ms.State == Alive {
+			addrs = append(addrs, ms.Addr)
+		}
+	}
+	rand.Shuffle(len(addrs), func(i, j int) {
+		addrs[i], addrs[j] = addrs[j], addrs[i]
+	})
+	if len(addrs) > k {
+		addrs = addrs[:k]
+	}
+	return addrs
+}
+
+//
+// suspect
+// @Description: 将成员标记为Suspect，怀疑超时的计时由merge开始
+// @receiver m
+// @param name
+// @param incarnation
+//
+func (m *Memberlist) suspect(name string, incarnation uint64) {
+	m.markState(name, incarnation, Suspect)
+}
+
+//
+// startSuspicion
+// @Description: 成员在怀疑超时后仍未以更高版本号反驳时标记为Dead，
+// 每个得知怀疑的节点各自计时，首个怀疑者离开后其余节点仍能判定
+// @receiver m
+// @param name
+// @param incarnation
+//
+func (m *Memberlist) startSuspicion(name string, incarnation uint64) {
+	time.AfterFunc(m.cfg.SuspectTimeout, func() {
+		select {
+		case <-m.done:
+		default:
+			m.markState(name, incarnation, Dead)
+		}
+	})
+}
+
+//
+// markState
+// @Description: 在成员版本号未变化时更新其状态，返回是否更新
+// @receiver m
+// @param name
+// @param incarnation
+// @param state
+// @return bool
+//
+func (m *Memberlist) markState(name string, incarnation uint64, state State) bool {
+	m.mu.Lock()
+	ms, ok := m.members[name]
+	if !ok || ms.Incarnation != incarnation || ms.State >= state {
+		m.mu.Unlock()
+		return false
+	}
+	member := ms.Member
+	m.mu.Unlock()
+	member.State = state
+	m.merge([]Member{member})
+	return true
+}
+
+//
+// reap
+// @Description: 清除Dead超过DeadReclaim的成员并留下墓碑，墓碑超过TombstoneTimeout后删除
+// @receiver m
+//
+func (m *Memberlist) reap() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for name, ms := range m.members {
+		if ms.State == Dead && now.Sub(ms.since) > m.cfg.DeadReclaim {
+			delete(m.members, name)
+			ms.since = now
+			m.tombstones[name] = ms
+		}
+	}
+	for name, ms := range m.tombstones {
+		if now.Sub(ms.since) > m.cfg.TombstoneTimeout {
+			delete(m.tombstones, name)
+		}
+	}
+}
+
+//
+// ping
+// @Description: 直接探测addr，在timeout内收到应答返回nil
+// @receiver m
+// @param addr
+// @param timeout
+// @return error
+//
+func (m *Memberlist) ping(addr string, timeout time.Duration) error {
+	seq, ch := m.registerAck()
+	if err := m.send(addr, message{Type: msgPing, Seq: seq, From: m.cfg.Name, Members: m.Members()}); err != nil {
+		m.cancelAck(seq)
+		return err
+	}
+	select {
+	case <-ch:
+		return nil
+	case <-time.After(timeout):
+		m.cancelAck(seq)
+		return fmt.Errorf("ping %s timeout", addr)
+	case <-m.done:
+		m.cancelAck(seq)
+		return errors.New("membership closed")
+	}
+}
+
+func (m *Memberlist) registerAck() (uint64, chan struct{}) {
+	m.ackMu.Lock()
+	defer m.ackMu.Unlock()
+	m.seq++
+	ch := make(chan struct{})
+	m.ackChans[m.seq] = ch
+	return m.seq, ch
+}
+
+func (m *Memberlist) cancelAck(seq uint64) {
+	m.ackMu.Lock()
+	delete(m.ackChans, seq)
+	m.ackMu.Unlock()
+}
+
+func (m *Memberlist) send(addr string, msg message) error {
+	udpAddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return err
+	}
+	buf, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = m.conn.WriteToUDP(buf, udpAddr)
+	return err
+}
@@ -0,0 +1,244 @@
+package membership
+
+import (
+	"gocache"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+//
+// newTestNode
+// @Description: 在回环地址上启动一个探测间隔很短的测试节点
+// @param t
+// @param name
+// @param mu
+// @param live 记录OnChange回调后的存活成员
+// @return *Memberlist
+//
+func newTestNode(t *testing.T, name string, mu *sync.Mutex, live map[string]bool) *Memberlist {
+	m, err := New(Config{
+		Name:           name,
+		BindAddr:       "127.0.0.1:0",
+		ProbeInterval:  20 * time.Millisecond,
+		ProbeTimeout:   10 * time.Millisecond,
+		SuspectTimeout: 100 * time.Millisecond,
+		OnChange: func(joined, left []string) {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, name := range joined {
+				live[name] = true
+			}
+			for _, name := range left {
+				delete(live, name)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	deadline := time.Now().Add(3 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timeout waiting for %s", what)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMembership(t *testing.T) {
+	names := []string{"http://a", "http://b", "http://c"}
+	var mu sync.Mutex
+	lives := make([]map[string]bool, len(names))
+	nodes := make([]*Memberlist, len(names))
+	for i, name := range names {
+		lives[i] = make(map[string]bool)
+		nodes[i] = newTestNode(t, name, &mu, lives[i])
+		defer nodes[i].Close()
+	}
+	for _, node := range nodes[1:] {
+		if err := node.Join(nodes[0].Addr()); err != nil {
+			t.Fatal(err)
+		}
+	}
+	converged := func(want []string, nodes ...int) func() bool {
+		return func() bool {
+			mu.Lock()
+			defer mu.Unlock()
+			for _, i := range nodes {
+				if len(lives[i]) != len(want) {
+					return false
+				}
+				for _, name := range want {
+					if !lives[i][name] {
+						return false
+					}
+				}
+			}
+			return true
+		}
+	}
+	waitFor(t, "all nodes join", converged(names, 0, 1, 2))
+	if live := nodes[2].Live(); !reflect.DeepEqual(live, names) {
+		t.Fatalf("unexpected live members %v", live)
+	}
+
+	//c直接宕机，a与b应在怀疑超时后将其判定为Dead
+	nodes[2].Close()
+	waitFor(t, "failure detected", converged(names[:2], 0, 1))
+	for _, member := range nodes[0].Members() {
+		if member.Name == "http://c" && member.State != Dead {
+			t.Fatalf("expected c dead, got %v", member.State)
+		}
+	}
+
+	//b主动离开，a无需等待探测超时
+	nodes[1].Leave()
+	waitFor(t, "graceful leave", converged(names[:1], 0))
+}
+
+func TestRefuteSuspicion(t *testing.T) {
+	var mu sync.Mutex
+	a := newTestNode(t, "http://a", &mu, make(map[string]bool))
+	defer a.Close()
+	b := newTestNode(t, "http://b", &mu, make(map[string]bool))
+	defer b.Close()
+	if err := b.Join(a.Addr()); err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "join", func() bool { return len(a.Live()) == 2 })
+
+	//a错误地怀疑b，b收到后递增版本号进行反驳
+	var inc uint64
+	for _, member := range a.Members() {
+		if member.Name == "http://b" {
+			inc = member.Incarnation
+		}
+	}
+	a.markState("http://b", inc, Suspect)
+	waitFor(t, "refute", func() bool {
+		for _, member := range a.Members() {
+			if member.Name == "http://b" {
+				return member.State == Alive && member.Incarnation > inc
+			}
+		}
+		return false
+	})
+	time.Sleep(150 * time.Millisecond)
+	if len(a.Live()) != 2 {
+		t.Fatalf("refuted member should stay alive")
+	}
+}
+
+func TestTombstone(t *testing.T) {
+	var mu sync.Mutex
+	a := newTestNode(t, "http://a", &mu, make(map[string]bool))
+	defer a.Close()
+	b := Member{Name: "http://b", Addr: "127.0.0.1:1", State: Alive, Incarnation: 1}
+	a.merge([]Member{b})
+	dead := b
+	dead.State = Dead
+	a.merge([]Member{dead})
+	//Dead超过DeadReclaim后被清除
+	a.mu.Lock()
+	a.members[b.Name].since = time.Now().Add(-2 * defaultDeadReclaim)
+	a.mu.Unlock()
+	a.reap()
+	if live := a.Live(); len(live) != 1 || len(a.Members()) != 1 {
+		t.Fatalf("expected b to be reaped, got %v", a.Members())
+	}
+
+	//其余成员捎带的旧状态不能使其复活
+	a.merge([]Member{b})
+	if live := a.Live(); len(live) != 1 {
+		t.Fatalf("stale gossip revived b: %v", live)
+	}
+	//重新加入后版本号更高，正常加入
+	b.Incarnation++
+	a.merge([]Member{b})
+	if live := a.Live(); !reflect.DeepEqual(live, []string{"http://a", "http://b"}) {
+		t.Fatalf("expected b to rejoin with a higher incarnation, got %v", live)
+	}
+}
+
+func TestSuspicionSpreads(t *testing.T) {
+	newNode := func(name string) *Memberlist {
+		//不主动探测，成员状态只通过手动合并传播
+		m, err := New(Config{
+			Name:           name,
+			BindAddr:       "127.0.0.1:0",
+			ProbeInterval:  time.Hour,
+			SuspectTimeout: 50 * time.Millisecond,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	a, b := newNode("http://a"), newNode("http://b")
+	defer b.Close()
+	c := Member{Name: "http://c", Addr: "127.0.0.1:1", State: Alive, Incarnation: 1}
+	a.merge([]Member{c})
+	b.merge([]Member{c})
+
+	//a怀疑c并将状态传给b后立即离开，b须自行计时将c判定为Dead
+	a.suspect(c.Name, c.Incarnation)
+	b.merge(a.Members())
+	a.Close()
+	waitFor(t, "suspect times out on b", func() bool {
+		for _, member := range b.Members() {
+			if member.Name == c.Name {
+				return member.State == Dead
+			}
+		}
+		return false
+	})
+}
+
+//
+// recordLogger
+// @Description: 记录日志消息的测试Logger
+//
+type recordLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (l *recordLogger) Enabled(gocache.Level) bool {
+	return true
+}
+
+func (l *recordLogger) Log(_ gocache.Level, msg string, _ ...gocache.Field) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, msg)
+}
+
+func TestLogger(t *testing.T) {
+	logger := &recordLogger{}
+	m, err := New(Config{Name: "http://a", BindAddr: "127.0.0.1:0", ProbeInterval: time.Hour, Logger: logger})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+	conn, err := net.Dial("udp", m.Addr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = conn.Write([]byte("not json")); err != nil {
+		t.Fatal(err)
+	}
+	//收到无法解析的包时通过Config中的Logger输出
+	waitFor(t, "bad packet log", func() bool {
+		logger.mu.Lock()
+		defer logger.mu.Unlock()
+		return reflect.DeepEqual(logger.msgs, []string{"membership bad packet"})
+	})
+}
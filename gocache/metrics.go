@@ -0,0 +1,234 @@
+package gocache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//
+// latencyBuckets
+// @Description: 耗时直方图的桶上界，单位秒
+//
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+//
+// histogram
+// @Description: 无锁的耗时直方图，桶计数不累加，导出时再按Prometheus的要求累加
+//
+type histogram struct {
+	counts [15]AtomicInt
+	//耗时累计，单位纳秒
+	sum AtomicInt
+}
+
+//
+// observe
+// @Description: 记录一次耗时
+// @receiver h
+// @param d
+//
+func (h *histogram) observe(d time.Duration) {
+	seconds := d.Seconds()
+	i := sort.SearchFloat64s(latencyBuckets, seconds)
+	h.counts[i].Add(1)
+	h.sum.Add(int64(d))
+}
+
+//
+// metricsWriter
+// @Description: 以Prometheus文本格式输出指标，调用方需先输出HELP与TYPE，再连续输出同名指标的全部样本
+//
+type metricsWriter struct {
+	w *bufio.Writer
+}
+
+func (m *metricsWriter) header(name, typ, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+func (m *metricsWriter) value(name, labels string, v int64) {
+	fmt.Fprintf(m.w, "%s{%s} %d\n", name, labels, v)
+}
+
+func (m *metricsWriter) histogram(name, labels string, h *histogram) {
+	//各桶只读取一次，+Inf与_count取自同一次累加，并发写入时也不会小于前面的桶
+	var cumulative [len(h.counts)]int64
+	var count int64
+	for i := range h.counts {
+		count += h.counts[i].Get()
+		cumulative[i] = count
+	}
+	for i, le := range latencyBuckets {
+		fmt.Fprintf(m.w, "%s_bucket{%s,le=\"%s\"} %d\n", name, labels, strconv.FormatFloat(le, 'g', -1, 64), cumulative[i])
+	}
+	fmt.Fprintf(m.w, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, count)
+	fmt.Fprintf(m.w, "%s_sum{%s} %s\n", name, labels, strconv.FormatFloat(time.Duration(h.sum.Get()).Seconds(), 'g', -1, 64))
+	fmt.Fprintf(m.w, "%s_count{%s} %d\n", name, labels, count)
+}
+
+//
+// writeGroupMetrics
+// @Description: 输出全部Group的计数器、缓存容量与加载耗时，按指标名逐个输出，同名指标的样本连续排列
+// @param m
+//
+func writeGroupMetrics(m *metricsWriter) {
+	list := allGroups()
+	stats := make([]GroupStats, len(list))
+	labels := make([]string, len(list))
+	for i, g := range list {
+		stats[i] = g.Stats()
+		labels[i] = label("group", g.name)
+	}
+	counters := []struct {
+		name, help string
+		v          func(s *GroupStats) int64
+	}{
+		{"gocache_gets_total", "Get calls including cache hits.", func(s *GroupStats) int64 { return s.Gets }},
+		{"gocache_cache_hits_total", "Gets served from main or hot cache.", func(s *GroupStats) int64 { return s.CacheHits }},
+		{"gocache_hot_hits_total", "Gets served from hot cache.", func(s *GroupStats) int64 { return s.HotHits }},
+		{"gocache_negative_hits_total", "Gets answered as not found by the negative cache.", func(s *GroupStats) int64 { return s.NegativeHits }},
+		{"gocache_stale_hits_total", "Gets served an expired value while it was refreshed.", func(s *GroupStats) int64 { return s.StaleHits }},
+		{"gocache_refreshes_total", "Background refreshes started.", func(s *GroupStats) int64 { return s.Refreshes }},
+		{"gocache_loads_total", "Gets that missed the cache.", func(s *GroupStats) int64 { return s.Loads }},
+		{"gocache_loads_deduped_total", "Loads actually executed after singleflight.", func(s *GroupStats) int64 { return s.LoadsDeduped }},
+		{"gocache_peer_loads_total", "Successful loads from peers.", func(s *GroupStats) int64 { return s.PeerLoads }},
+		{"gocache_peer_errors_total", "Failed loads from peers.", func(s *GroupStats) int64 { return s.PeerErrors }},
+		{"gocache_local_loads_total", "Successful loads from the getter.", func(s *GroupStats) int64 { return s.LocalLoads }},
+		{"gocache_local_load_errors_total", "Failed loads from the getter.", func(s *GroupStats) int64 { return s.LocalLoadErrs }},
+		{"gocache_server_requests_total", "Requests received from peers.", func(s *GroupStats) int64 { return s.ServerRequests }},
+		{"gocache_handoffs_total", "Keys handed off to their new owners after a ring change.", func(s *GroupStats) int64 { return s.Handoffs }},
+		{"gocache_l2_hits_total", "Loads served from the l2 cache.", func(s *GroupStats) int64 { return s.L2Hits }},
+		{"gocache_l2_spills_total", "Evicted keys written to the l2 cache.", func(s *GroupStats) int64 { return s.L2Spills }},
+	}
+	for _, c := range counters {
+		m.header(c.name, "counter", c.help)
+		for i := range list {
+			m.value(c.name, labels[i], c.v(&stats[i]))
+		}
+	}
+	caches := []struct {
+		name  string
+		stats func(s *GroupStats) CacheStats
+	}{
+		{"main", func(s *GroupStats) CacheStats { return s.MainCache }},
+		{"hot", func(s *GroupStats) CacheStats { return s.HotCache }},
+		{"negative", func(s *GroupStats) CacheStats { return s.NegativeCache }},
+	}
+	gauges := []struct {
+		name, typ, help string
+		v               func(s CacheStats) int64
+	}{
+		{"gocache_cache_bytes", "gauge", "Bytes held in the cache.", func(s CacheStats) int64 { return s.Bytes }},
+		{"gocache_cache_items", "gauge", "Items held in the cache.", func(s CacheStats) int64 { return s.Items }},
+		{"gocache_cache_evictions_total", "counter", "Items evicted, expired or removed from the cache.", func(s CacheStats) int64 { return s.Evictions }},
+	}
+	for _, f := range gauges {
+		m.header(f.name, f.typ, f.help)
+		for i := range list {
+			for _, c := range caches {
+				m.value(f.name, labels[i]+","+label("cache", c.name), f.v(c.stats(&stats[i])))
+			}
+		}
+	}
+	m.header("gocache_load_duration_seconds", "histogram", "Latency of loading a key through the getter.")
+	for i, g := range list {
+		m.histogram("gocache_load_duration_seconds", labels[i], &g.loadLatency)
+	}
+}
+
+//
+// writePeerMetrics
+// @Description: 输出客户端视角下各远程节点的请求数、错误数与耗时，同名指标的样本连续排列
+// @param m
+// @param peers
+//
+func writePeerMetrics(m *metricsWriter, peers map[string]*peerStats) {
+	names := make([]string, 0, len(peers))
+	for name := range peers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	families := []struct {
+		name, typ, help string
+		v               func(s *peerStats) int64
+	}{
+		{"gocache_peer_requests_total", "counter", "Requests sent to the peer.", func(s *peerStats) int64 { return s.requests.Get() }},
+		{"gocache_peer_request_errors_total", "counter", "Failed requests sent to the peer.", func(s *peerStats) int64 { return s.errors.Get() }},
+		{"gocache_peer_inflight_requests", "gauge", "Requests to the peer that have not completed.", func(s *peerStats) int64 { return s.inflight.Get() }},
+	}
+	for _, f := range families {
+		m.header(f.name, f.typ, f.help)
+		for _, name := range names {
+			m.value(f.name, label("peer", name), f.v(peers[name]))
+		}
+	}
+	m.header("gocache_peer_request_duration_seconds", "histogram", "Latency of requests sent to the peer.")
+	for _, name := range names {
+		m.histogram("gocache_peer_request_duration_seconds", label("peer", name), &peers[name].hist)
+	}
+}
+
+//
+// serveMetrics
+// @Description: 以Prometheus文本格式输出Group与HTTPPool的指标
+// @receiver p
+// @param w
+// @param r
+//
+func (p *HTTPPool) serveMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m := &metricsWriter{w: bufio.NewWriter(w)}
+	writeGroupMetrics(m)
+	p.mu.Lock()
+	peers := make(map[string]*peerStats, len(p.httpGetters))
+	for peer, getter := range p.httpGetters {
+		if peer != p.self {
+			peers[peer] = &getter.stats
+		}
+	}
+	p.mu.Unlock()
+	writePeerMetrics(m, peers)
+	m.w.Flush()
+}
+
+//
+// WriteMetrics
+// @Description: 将全部Group的指标以Prometheus文本格式写入w，便于挂载到已有的metrics接口
+// @param w
+// @return error
+//
+func WriteMetrics(w io.Writer) error {
+	m := &metricsWriter{w: bufio.NewWriter(w)}
+	writeGroupMetrics(m)
+	return m.w.Flush()
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func label(name, value string) string {
+	return name + `="` + labelEscaper.Replace(value) + `"`
+}
+
+//
+// allGroups
+// @Description: 按名称排序返回全部Group
+// @return []*Group
+//
+func allGroups() []*Group {
+	mu.RLock()
+	list := make([]*Group, 0, len(groups))
+	for _, g := range groups {
+		list = append(list, g)
+	}
+	mu.RUnlock()
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].name < list[j].name
+	})
+	return list
+}
@@ -0,0 +1,34 @@
+package gocache
+
+import "time"
+
+//
+// lookupNegative
+// @Description: 查询key是否在短时间内被确认为不存在
+// @receiver g
+// @param key
+// @return bool
+//
+func (g *Group) lookupNegative(key string) bool {
+	if g.negativeTTL <= 0 {
+		return false
+	}
+	if _, ok := g.negativeCache.get(key); ok {
+		g.stats.negativeHits.Add(1)
+		return true
+	}
+	return false
+}
+
+//
+// populateNegative
+// @Description: 记录key不存在，有效期为negativeTTL，期间的请求不再回源
+// @receiver g
+// @param key
+//
+func (g *Group) populateNegative(key string) {
+	if g.negativeTTL <= 0 {
+		return
+	}
+	g.negativeCache.add(key, ByteView{e: time.Now().Add(g.negativeTTL)})
+}
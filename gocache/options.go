@@ -0,0 +1,282 @@
+package gocache
+
+import "time"
+
+//
+// GroupOption
+// @Description: Group的可选配置项，在NewGroup时传入
+//
+type GroupOption func(g *Group)
+
+//
+// WithExpiration
+// @Description: 设置Group默认的缓存过期时长，0表示永不过期
+// @param d
+// @return GroupOption
+//
+func WithExpiration(d time.Duration) GroupOption {
+	return func(g *Group) {
+		g.expiration = d
+	}
+}
+
+//
+// WithSweepInterval
+// @Description: 设置后台清理过期缓存的间隔
+// @param d
+// @return GroupOption
+//
+func WithSweepInterval(d time.Duration) GroupOption {
+	return func(g *Group) {
+		g.mainCache.sweepInterval = d
+	}
+}
+
+//
+// WithHotCache
+// @Description: 开启热点缓存，从cacheBytes中划出ratio比例的空间，抽样保存从远程节点获取的key
+// @param ratio 取值范围(0, 1)，超出范围时NewGroup会panic
+// @return GroupOption
+//
+func WithHotCache(ratio float64) GroupOption {
+	return func(g *Group) {
+		g.hotCacheRatio = ratio
+	}
+}
+
+//
+// WithEvictionPolicy
+// @Description: 设置主缓存与热点缓存的淘汰策略，默认为LRU
+// @param policy
+// @return GroupOption
+//
+func WithEvictionPolicy(policy PolicyFunc) GroupOption {
+	return func(g *Group) {
+		g.mainCache.newPolicy = policy
+		g.hotCache.newPolicy = policy
+	}
+}
+
+//
+// WithShards
+// @Description: 设置本地缓存的分片数，每个分片独立加锁并平分容量，默认按GOMAXPROCS与cacheBytes自动计算
+// @param n
+// @return GroupOption
+//
+func WithShards(n int) GroupOption {
+	return func(g *Group) {
+		g.mainCache.shardCount = n
+		g.hotCache.shardCount = n
+		g.negativeCache.shardCount = n
+	}
+}
+
+//
+// WithMaxEntryBytes
+// @Description: 设置单条记录（key与value）的最大字节数，分片数会减少到每个分片都能容纳该大小的记录，
+// 未设置时超过分片容量的记录写入后会立即被淘汰
+// @param n 不能大于cacheBytes
+// @return GroupOption
+//
+func WithMaxEntryBytes(n int64) GroupOption {
+	return func(g *Group) {
+		g.mainCache.maxEntryBytes = n
+		g.hotCache.maxEntryBytes = n
+	}
+}
+
+//
+// WithNegativeCache
+// @Description: 开启负缓存，回调或归属节点返回ErrNotFound的key在ttl内直接返回不存在，
+// 负缓存最多占用maxBytes字节，不计入cacheBytes
+// @param ttl
+// @param maxBytes 不大于0时使用默认上限1MB
+// @return GroupOption
+//
+func WithNegativeCache(ttl time.Duration, maxBytes int64) GroupOption {
+	return func(g *Group) {
+		g.negativeTTL = ttl
+		g.negativeCache.cacheBytes = maxBytes
+	}
+}
+
+//
+// WithStaleWhileRevalidate
+// @Description: 缓存过期后的window时长内仍直接返回旧值，同时在后台刷新，避免热点key过期时调用方集中等待
+// @param window
+// @return GroupOption
+//
+func WithStaleWhileRevalidate(window time.Duration) GroupOption {
+	return func(g *Group) {
+		g.stale = window
+	}
+}
+
+//
+// WithRefreshAhead
+// @Description: 缓存在生命周期最后fraction比例内被访问时提前在后台刷新，fraction取值(0,1)
+// @param fraction
+// @return GroupOption
+//
+func WithRefreshAhead(fraction float64) GroupOption {
+	return func(g *Group) {
+		g.refreshAhead = fraction
+	}
+}
+
+//
+// WithMaxRefreshes
+// @Description: 设置后台刷新的并发上限，超出时放弃本次刷新，默认为defaultMaxRefreshes
+// @param n
+// @return GroupOption
+//
+func WithMaxRefreshes(n int) GroupOption {
+	return func(g *Group) {
+		g.maxRefreshes = n
+	}
+}
+
+//
+// WithL2Cache
+// @Description: 开启二级缓存，主缓存因容量淘汰的记录写入l2，Get在查询远程节点与回调之前先查找l2，
+// 磁盘实现见diskcache包
+// @param l2
+// @return GroupOption
+//
+func WithL2Cache(l2 L2Cache) GroupOption {
+	return func(g *Group) {
+		g.l2 = l2
+	}
+}
+
+//
+// WithLoadTimeout
+// @Description: 设置共享加载的超时上限，加载由首个未命中的调用方发起并由并发调用方共享，
+// 不受单个调用方取消的影响，截止时间取各调用方中最晚者且不超过该上限，默认为defaultLoadTimeout
+// @param d
+// @return GroupOption
+//
+func WithLoadTimeout(d time.Duration) GroupOption {
+	return func(g *Group) {
+		g.loadTimeout = d
+	}
+}
+
+//
+// WithLogger
+// @Description: 设置Group的日志，默认使用标准库log输出Info及以上级别，NopLogger可关闭全部日志
+// @param l
+// @return GroupOption
+//
+func WithLogger(l Logger) GroupOption {
+	return func(g *Group) {
+		g.logger = l
+	}
+}
+
+//
+// HTTPPoolOption
+// @Description: HTTPPool的可选配置项，在NewHTTPPool时传入
+//
+type HTTPPoolOption func(p *HTTPPool)
+
+//
+// WithAdminPath
+// @Description: 开启运维管理接口，可在运行时加入或摘除节点，须同时使用WithAdminToken设置访问令牌
+// @param path
+// @return HTTPPoolOption
+//
+func WithAdminPath(path string) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.adminPath = path
+	}
+}
+
+//
+// WithAdminToken
+// @Description: 设置运维管理接口的访问令牌，请求需携带Authorization: Bearer <token>，否则返回401
+// @param token
+// @return HTTPPoolOption
+//
+func WithAdminToken(token string) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.adminToken = token
+	}
+}
+
+//
+// WithPlacement
+// @Description: 指定节点分布算法，默认为ConsistentHash，所有节点须使用相同的算法
+// @param fn
+// @return HTTPPoolOption
+//
+func WithPlacement(fn PlacementFunc) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.newPlacement = fn
+	}
+}
+
+//
+// WithBoundedLoad
+// @Description: 开启有界负载的一致性哈希，节点进行中的请求数超出平均值的factor倍时顺延至哈希环上的下一个节点，
+// 避免热点key集中的节点过载。同一key在负载变化时可能由不同节点处理，factor通常取1.25。
+// 仅对实现了BoundedPlacement的节点分布算法生效，不能与副本数大于1的WithReplication同时使用
+// @param factor 不小于1，否则NewHTTPPool会panic
+// @return HTTPPoolOption
+//
+func WithBoundedLoad(factor float64) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.loadFactor = factor
+	}
+}
+
+//
+// WithReplication
+// @Description: 每个key除归属节点外还保存在哈希环上紧随其后的n-1个节点上，
+// 归属节点故障时依次向副本节点查询，写入与删除会同步至全部副本。仅对实现了ReplicatedPlacement的节点分布算法生效，
+// n大于1时不能与WithBoundedLoad同时使用
+// @param n 副本数，包括归属节点，不小于1，否则NewHTTPPool会panic
+// @return HTTPPoolOption
+//
+func WithReplication(n int) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.replication = n
+	}
+}
+
+//
+// WithHandoff
+// @Description: 节点变更后将不再由本节点负责的缓存按rate条每秒的速率推送给新的归属节点，
+// 新节点无需全部从回调函数加载，推送失败的记录稍后重试
+// @param rate 每秒最多推送的记录数
+// @return HTTPPoolOption
+//
+func WithHandoff(rate int) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.handoffRate = rate
+	}
+}
+
+//
+// WithMetricsPath
+// @Description: 开启Prometheus文本格式的指标接口，通常与defaultBasePath并列，如"/_gocache_metrics"
+// @param path
+// @return HTTPPoolOption
+//
+func WithMetricsPath(path string) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.metricsPath = path
+	}
+}
+
+//
+// WithPoolLogger
+// @Description: 设置HTTPPool的日志，默认使用标准库log输出Info及以上级别
+// @param l
+// @return HTTPPoolOption
+//
+func WithPoolLogger(l Logger) HTTPPoolOption {
+	return func(p *HTTPPool) {
+		p.logger = l
+	}
+}
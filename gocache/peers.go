@@ -1,6 +1,7 @@
 package gocache
 
 import (
+	"context"
 	pb "gocache/gocachepb"
 )
 
@@ -12,10 +13,26 @@ type PeerPicker interface {
 	PickPeer(key string) (peer PeerGetter, ok bool)
 }
 
+//
+// ReplicaPicker
+// @Description: 支持多副本的PeerPicker，key保存在归属节点及其后的若干副本节点上
+//
+type ReplicaPicker interface {
+	PeerPicker
+	//按优先级返回key的全部副本节点，第一个为归属节点，本节点对应的元素为nil
+	PickReplicas(key string) []PeerGetter
+}
+
 //
 // PeerGetter
 // @Description: 节点必须实现以支持节点缓存查询
 //
 type PeerGetter interface {
-	Get(in *pb.Request, out *pb.Response) error
+	Get(ctx context.Context, in *pb.Request, out *pb.Response) error
+	//写入远程节点缓存
+	Set(ctx context.Context, in *pb.SetRequest, out *pb.Response) error
+	//删除远程节点缓存
+	Remove(ctx context.Context, in *pb.Request, out *pb.Response) error
+	//批量查询远程节点缓存
+	GetMany(ctx context.Context, in *pb.BatchRequest, out *pb.BatchResponse) error
 }
@@ -0,0 +1,75 @@
+package gocache
+
+import (
+	"gocache/consistenthash"
+	"gocache/jump"
+	"gocache/maglev"
+	"gocache/rendezvous"
+)
+
+//
+// Placement
+// @Description: 决定key由哪个节点负责，HTTPPool只依赖该接口，实现无需并发安全。
+// 所有节点须使用相同的实现与参数，否则对key的归属会产生分歧
+//
+type Placement interface {
+	//添加权重为1的节点，已存在的节点会被忽略
+	Add(nodes ...string)
+	Remove(nodes ...string)
+	//返回key的归属节点，没有节点时返回空字符串
+	Get(key string) string
+}
+
+//
+// WeightedPlacement
+// @Description: 支持节点权重的Placement，节点负责的key数量与权重成正比
+//
+type WeightedPlacement interface {
+	Placement
+	//调整节点权重，节点不存在时加入，权重不大于0时移除
+	SetWeight(node string, weight int)
+	Weight(node string) int
+}
+
+//
+// BoundedPlacement
+// @Description: 支持有界负载的Placement，归属节点负载超出平均值的factor倍时顺延至其他节点
+//
+type BoundedPlacement interface {
+	Placement
+	GetBounded(key string, factor float64, load func(node string) int64) string
+}
+
+//
+// ReplicatedPlacement
+// @Description: 支持多副本的Placement，按优先级返回key的归属节点与副本节点
+//
+type ReplicatedPlacement interface {
+	Placement
+	GetN(key string, n int) []string
+}
+
+//
+// PlacementFunc
+// @Description: Placement的构造函数，节点变更时HTTPPool会调用它重建
+//
+type PlacementFunc func() Placement
+
+var (
+	//基于虚拟节点的一致性哈希环，默认实现，支持权重、有界负载与多副本
+	ConsistentHash PlacementFunc = func() Placement {
+		return consistenthash.New(defaultReplicas, nil)
+	}
+	//最高随机权重哈希，支持权重与多副本，查找开销与节点数成正比
+	Rendezvous PlacementFunc = func() Placement {
+		return rendezvous.New()
+	}
+	//jump一致性哈希，分布均匀且无额外内存，桶编号与加入顺序有关，HTTPPool在节点变更时按地址顺序重建以保证各节点结果一致
+	JumpHash PlacementFunc = func() Placement {
+		return jump.New()
+	}
+	//Maglev哈希，查找表分布最均匀，节点变更时需重建查找表
+	Maglev PlacementFunc = func() Placement {
+		return maglev.New(0)
+	}
+)
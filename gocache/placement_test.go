@@ -0,0 +1,146 @@
+package gocache
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+var placements = []struct {
+	name string
+	fn   PlacementFunc
+}{
+	{"consistenthash", ConsistentHash},
+	{"rendezvous", Rendezvous},
+	{"jump", JumpHash},
+	{"maglev", Maglev},
+}
+
+//
+// placementOwners
+// @Description: 返回前n个key的归属节点
+// @param p
+// @param n
+// @return []string
+//
+func placementOwners(p Placement, n int) []string {
+	owners := make([]string, n)
+	for i := range owners {
+		owners[i] = p.Get(strconv.Itoa(i))
+	}
+	return owners
+}
+
+func movedRatio(before, after []string) float64 {
+	moved := 0
+	for i := range before {
+		if before[i] != after[i] {
+			moved++
+		}
+	}
+	return float64(moved) / float64(len(before))
+}
+
+//
+// TestPlacements
+// @Description: 对比各节点分布算法在增删节点时移动的key比例与各节点分得key数的变异系数
+// @param t
+//
+func TestPlacements(t *testing.T) {
+	const keys, nodes = 100000, 10
+	for _, tc := range placements {
+		t.Run(tc.name, func(t *testing.T) {
+			p := tc.fn()
+			for i := 0; i < nodes; i++ {
+				p.Add("http://node" + strconv.Itoa(i))
+			}
+			before := placementOwners(p, keys)
+			counts := make(map[string]float64)
+			for _, owner := range before {
+				counts[owner]++
+			}
+			var sq float64
+			mean := float64(keys) / nodes
+			for _, c := range counts {
+				sq += (c - mean) * (c - mean)
+			}
+			cv := math.Sqrt(sq/nodes) / mean
+
+			p.Add("http://node10")
+			added := placementOwners(p, keys)
+			p.Remove("http://node3")
+			removed := placementOwners(p, keys)
+			addMoved, removeMoved := movedRatio(before, added), movedRatio(added, removed)
+			t.Logf("cv %.4f, moved on add %.4f, moved on remove %.4f (ideal %.4f)", cv, addMoved, removeMoved, 1.0/11)
+
+			if len(counts) != nodes || cv > 0.25 {
+				t.Fatalf("uneven distribution, cv %.4f: %v", cv, counts)
+			}
+			if addMoved > 1.5/11 {
+				t.Fatalf("too many keys moved on add: %.4f", addMoved)
+			}
+			//jump删除中间节点时还需移动最后一个节点
+			if removeMoved > 2.5/11 {
+				t.Fatalf("too many keys moved on remove: %.4f", removeMoved)
+			}
+		})
+	}
+}
+
+func TestHTTPPoolPlacement(t *testing.T) {
+	for _, tc := range placements {
+		pool := NewHTTPPool("http://self", WithPlacement(tc.fn))
+		pool.SetWeighted(map[string]int{"http://self": 1, "http://a": 2})
+		picked := 0
+		for i := 0; i < 1000; i++ {
+			if peer, ok := pool.PickPeer(strconv.Itoa(i)); ok {
+				if peer != pool.httpGetters["http://a"] {
+					t.Fatalf("%s: unexpected peer %v", tc.name, peer)
+				}
+				picked++
+			}
+		}
+		if picked == 0 || picked == 1000 {
+			t.Fatalf("%s: expected keys to be split between nodes, %d picked remote", tc.name, picked)
+		}
+		//不支持权重的算法按权重1处理
+		_, weighted := pool.peers.(WeightedPlacement)
+		if w := pool.Weights()["http://a"]; weighted && w != 2 || !weighted && w != 1 {
+			t.Fatalf("%s: unexpected weight %d", tc.name, w)
+		}
+		pool.RemovePeers("http://a")
+		if _, ok := pool.PickPeer("k"); ok {
+			t.Fatalf("%s: expected all keys to be local after removing http://a", tc.name)
+		}
+	}
+}
+
+func TestHTTPPoolSetOrder(t *testing.T) {
+	peers := []string{"http://c", "http://a", "http://d", "http://b"}
+	a := NewHTTPPool("http://self", WithPlacement(JumpHash))
+	a.Set(peers...)
+	b := NewHTTPPool("http://self", WithPlacement(JumpHash))
+	b.Set(peers[3], peers[2], peers[1], peers[0])
+	//jump的桶编号取决于加入顺序，Set按地址排序后各节点结果一致
+	if owners, other := placementOwners(a.peers, 1000), placementOwners(b.peers, 1000); movedRatio(owners, other) != 0 {
+		t.Fatalf("expected the same owners regardless of peer order")
+	}
+}
+
+func TestHTTPPoolIncrementalPlacement(t *testing.T) {
+	for _, tc := range placements {
+		//模拟运行时通过管理接口增删节点的节点
+		a := NewHTTPPool("http://self", WithPlacement(tc.fn))
+		a.Set("http://a", "http://b", "http://c", "http://d")
+		a.RemovePeers("http://b")
+		a.AddPeers("http://e", "http://b")
+		a.RemovePeers("http://a")
+		a.SetWeight("http://f", 1)
+		//模拟以最终节点列表重启的节点
+		b := NewHTTPPool("http://self", WithPlacement(tc.fn))
+		b.Set("http://f", "http://e", "http://d", "http://c", "http://b")
+		if owners, other := placementOwners(a.peers, 1000), placementOwners(b.peers, 1000); movedRatio(owners, other) != 0 {
+			t.Fatalf("%s: expected an incrementally built pool to match one built from scratch", tc.name)
+		}
+	}
+}
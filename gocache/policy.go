@@ -0,0 +1,55 @@
+package gocache
+
+import (
+	"gocache/arc"
+	"gocache/lfu"
+	"gocache/lru"
+	"gocache/tinylfu"
+	"gocache/twoq"
+	"time"
+)
+
+//
+// EvictionPolicy
+// @Description: 缓存淘汰策略，cache只依赖该接口，实现无需并发安全。
+// 占用内存按len(key)+value.Len()计算，超出maxBytes时淘汰，maxBytes为0表示不限制
+//
+type EvictionPolicy interface {
+	Get(key string) (lru.Value, bool)
+	AddWithExpire(key string, value lru.Value, expire time.Time)
+	Remove(key string) bool
+	RemoveExpired() int
+	Bytes() int64
+	Len() int
+	//按淘汰顺序遍历未过期的记录，最先被淘汰的在前，不改变访问顺序
+	Range(fn func(key string, value lru.Value, expire time.Time) bool)
+}
+
+//
+// PolicyFunc
+// @Description: 淘汰策略的构造函数，onEvicted在记录被淘汰、过期清理或删除时调用
+//
+type PolicyFunc func(maxBytes int64, onEvicted func(key string, value lru.Value)) EvictionPolicy
+
+var (
+	//最近最少使用，默认策略
+	LRU PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value)) EvictionPolicy {
+		return lru.New(maxBytes, onEvicted)
+	}
+	//最不经常使用
+	LFU PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value)) EvictionPolicy {
+		return lfu.New(maxBytes, onEvicted)
+	}
+	//自适应替换
+	ARC PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value)) EvictionPolicy {
+		return arc.New(maxBytes, onEvicted)
+	}
+	//2Q，适合混有大量一次性扫描的场景
+	TwoQ PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value)) EvictionPolicy {
+		return twoq.New(maxBytes, onEvicted)
+	}
+	//W-TinyLFU，按访问频次决定是否接纳新记录，适合Zipf分布的访问
+	TinyLFU PolicyFunc = func(maxBytes int64, onEvicted func(string, lru.Value)) EvictionPolicy {
+		return tinylfu.New(maxBytes, onEvicted)
+	}
+)
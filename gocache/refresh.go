@@ -0,0 +1,93 @@
+package gocache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+const (
+	//默认的后台刷新并发上限
+	defaultMaxRefreshes = 8
+)
+
+//
+// maybeRefresh
+// @Description: 缓存命中后检查是否需要后台刷新：已过期但仍在容忍期内的旧值，
+// 或者处于生命周期最后refreshAhead比例内的值
+// @receiver g
+// @param key
+// @param value
+//
+func (g *Group) maybeRefresh(key string, value ByteView) {
+	if value.e.IsZero() || g.refreshes == nil {
+		return
+	}
+	now := time.Now()
+	if now.After(value.e) {
+		g.stats.staleHits.Add(1)
+		g.refreshInBackground(key)
+		return
+	}
+	if g.refreshAhead <= 0 || value.l.IsZero() {
+		return
+	}
+	ahead := time.Duration(float64(value.e.Sub(value.l)) * g.refreshAhead)
+	if now.After(value.e.Add(-ahead)) {
+		g.refreshInBackground(key)
+	}
+}
+
+//
+// refreshInBackground
+// @Description: 启动后台刷新，同一个key同时只刷新一次，超过并发上限时放弃本次刷新
+// @receiver g
+// @param key
+//
+func (g *Group) refreshInBackground(key string) {
+	g.refreshMu.Lock()
+	if _, ok := g.refreshing[key]; ok {
+		g.refreshMu.Unlock()
+		return
+	}
+	select {
+	case g.refreshes <- struct{}{}:
+	default:
+		g.refreshMu.Unlock()
+		return
+	}
+	g.refreshing[key] = struct{}{}
+	g.refreshMu.Unlock()
+	g.stats.refreshes.Add(1)
+	go func() {
+		defer func() {
+			g.refreshMu.Lock()
+			delete(g.refreshing, key)
+			g.refreshMu.Unlock()
+			<-g.refreshes
+		}()
+		g.refresh(key)
+	}()
+}
+
+//
+// refresh
+// @Description: 绕过缓存重新加载key，远程节点负责的key刷新到热点缓存
+// @receiver g
+// @param key
+//
+func (g *Group) refresh(key string) {
+	value, err := g.load(context.Background(), key)
+	if errors.Is(err, ErrNotFound) {
+		g.mainCache.remove(key)
+		g.hotCache.remove(key)
+		return
+	}
+	if err != nil {
+		//刷新失败时保留旧值，容忍期结束后自然淘汰
+		return
+	}
+	if _, ok := g.pickPeer(key); ok && g.hotCacheRatio > 0 {
+		g.hotCache.add(key, value)
+	}
+}
@@ -0,0 +1,179 @@
+package rendezvous
+
+import (
+	"gocache/internal/fnv1a"
+	"math"
+	"sort"
+)
+
+//
+// Map
+// @Description: 最高随机权重（HRW）哈希，key与每个节点分别计算得分，得分最高的节点负责该key。
+// 增删节点时只有归属该节点的key会移动，代价是每次查找需要遍历全部节点
+//
+type Map struct {
+	//按名称排序的节点，保证得分相同时各进程选出同一节点
+	nodes []*node
+}
+
+type node struct {
+	name string
+	//节点名称的哈希值，与key的哈希混合后得到得分
+	hash   uint64
+	weight int
+}
+
+//
+// New
+// @Description: 实例化Map
+// @return *Map
+//
+func New() *Map {
+	return &Map{}
+}
+
+//
+// score
+// @Description: 计算key在节点上的得分，权重为1时直接比较哈希值，
+// 否则按-weight/ln(u)计算，节点被选中的概率与权重成正比
+// @receiver n
+// @param keyHash
+// @return float64
+//
+func (n *node) score(keyHash uint64) float64 {
+	h := fnv1a.Mix64(keyHash ^ n.hash)
+	//取高53位映射到(0,1)
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	return -float64(n.weight) / math.Log(u)
+}
+
+//
+// Add
+// @Description: 添加权重为1的节点，已存在的节点会被忽略
+// @receiver m
+// @param keys
+//
+func (m *Map) Add(keys ...string) {
+	for _, key := range keys {
+		if m.Weight(key) == 0 {
+			m.SetWeight(key, 1)
+		}
+	}
+}
+
+//
+// SetWeight
+// @Description: 调整节点权重，节点不存在时加入，权重不大于0时移除
+// @receiver m
+// @param key
+// @param weight
+//
+func (m *Map) SetWeight(key string, weight int) {
+	i := sort.Search(len(m.nodes), func(i int) bool {
+		return m.nodes[i].name >= key
+	})
+	exists := i < len(m.nodes) && m.nodes[i].name == key
+	switch {
+	case weight <= 0 && exists:
+		m.nodes = append(m.nodes[:i], m.nodes[i+1:]...)
+	case weight > 0 && exists:
+		m.nodes[i].weight = weight
+	case weight > 0:
+		m.nodes = append(m.nodes, nil)
+		copy(m.nodes[i+1:], m.nodes[i:])
+		m.nodes[i] = &node{name: key, hash: fnv1a.Mix64(fnv1a.Sum64(key)), weight: weight}
+	}
+}
+
+//
+// Weight
+// @Description: 返回节点权重，节点不存在时为0
+// @receiver m
+// @param key
+// @return int
+//
+func (m *Map) Weight(key string) int {
+	i := sort.Search(len(m.nodes), func(i int) bool {
+		return m.nodes[i].name >= key
+	})
+	if i < len(m.nodes) && m.nodes[i].name == key {
+		return m.nodes[i].weight
+	}
+	return 0
+}
+
+//
+// Remove
+// @Description: 删除节点，其负责的key分散到其余节点
+// @receiver m
+// @param keys
+//
+func (m *Map) Remove(keys ...string) {
+	for _, key := range keys {
+		m.SetWeight(key, 0)
+	}
+}
+
+//
+// Get
+// @Description: 返回得分最高的节点
+// @receiver m
+// @param key
+// @return string
+//
+func (m *Map) Get(key string) string {
+	if len(key) == 0 || m.IsEmpty() {
+		return ""
+	}
+	keyHash := fnv1a.Sum64(key)
+	var best *node
+	bestScore := math.Inf(-1)
+	for _, n := range m.nodes {
+		if s := n.score(keyHash); s > bestScore {
+			best, bestScore = n, s
+		}
+	}
+	return best.name
+}
+
+//
+// GetN
+// @Description: 按得分从高到低返回至多n个节点，第一个即Get的结果，其余为副本节点
+// @receiver m
+// @param key
+// @param n
+// @return []string
+//
+func (m *Map) GetN(key string, n int) []string {
+	if len(key) == 0 || m.IsEmpty() || n <= 0 {
+		return nil
+	}
+	if n > len(m.nodes) {
+		n = len(m.nodes)
+	}
+	keyHash := fnv1a.Sum64(key)
+	scores := make([]float64, len(m.nodes))
+	order := make([]int, len(m.nodes))
+	for i, node := range m.nodes {
+		scores[i], order[i] = node.score(keyHash), i
+	}
+	//得分相同时保持名称顺序，与Get的结果一致
+	sort.SliceStable(order, func(i, j int) bool {
+		return scores[order[i]] > scores[order[j]]
+	})
+	nodes := make([]string, n)
+	for i := range nodes {
+		nodes[i] = m.nodes[order[i]].name
+	}
+	return nodes
+}
+
+//
+// IsEmpty
+// @Description: 是否没有节点
+// @receiver m
+// @return bool
+//
+func (m *Map) IsEmpty() bool {
+	return len(m.nodes) == 0
+}
@@ -0,0 +1,97 @@
+package rendezvous
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func owners(m *Map, n int) []string {
+	owners := make([]string, n)
+	for i := range owners {
+		owners[i] = m.Get(strconv.Itoa(i))
+	}
+	return owners
+}
+
+func TestGet(t *testing.T) {
+	m := New()
+	if m.Get("k") != "" {
+		t.Fatalf("expected empty map to return no node")
+	}
+	m.Add("a", "b", "c")
+	//节点加入顺序不影响结果
+	other := New()
+	other.Add("c", "a", "b")
+	for i := 0; i < 1000; i++ {
+		key := strconv.Itoa(i)
+		if m.Get(key) != other.Get(key) {
+			t.Fatalf("key %s picked %s and %s", key, m.Get(key), other.Get(key))
+		}
+		if nodes := m.GetN(key, 2); len(nodes) != 2 || nodes[0] != m.Get(key) || nodes[0] == nodes[1] {
+			t.Fatalf("unexpected replicas %v of key %s", nodes, key)
+		}
+	}
+}
+
+func TestMovement(t *testing.T) {
+	const keys = 100000
+	m := New()
+	for i := 0; i < 10; i++ {
+		m.Add("node" + strconv.Itoa(i))
+	}
+	before := owners(m, keys)
+
+	//新节点只接管其余节点的key
+	m.Add("node10")
+	moved := 0
+	for i, owner := range owners(m, keys) {
+		if owner != before[i] {
+			if owner != "node10" {
+				t.Fatalf("key %d moved from %s to %s", i, before[i], owner)
+			}
+			moved++
+		}
+	}
+	if ratio := float64(moved) / keys; math.Abs(ratio-1.0/11) > 0.01 {
+		t.Fatalf("expected about 1/11 keys to move on add, got %.4f", ratio)
+	}
+
+	//删除节点只移动该节点的key
+	m.Remove("node3")
+	for i, owner := range owners(m, keys) {
+		if before[i] != "node3" && owner != before[i] && owner != "node10" {
+			t.Fatalf("key %d moved from %s to %s", i, before[i], owner)
+		}
+		if owner == "node3" {
+			t.Fatalf("key %d still owned by removed node", i)
+		}
+	}
+}
+
+func TestDistribution(t *testing.T) {
+	const keys = 100000
+	m := New()
+	for i := 0; i < 10; i++ {
+		m.Add("node" + strconv.Itoa(i))
+	}
+	m.SetWeight("node0", 3)
+	counts := make(map[string]int)
+	for _, owner := range owners(m, keys) {
+		counts[owner]++
+	}
+	//权重为3的节点约分得3/12的key，其余节点各约1/12
+	if ratio := float64(counts["node0"]) / keys; math.Abs(ratio-0.25) > 0.01 {
+		t.Fatalf("expected node0 to own about 1/4 keys, got %.4f", ratio)
+	}
+	var sum, sq float64
+	for i := 1; i < 10; i++ {
+		c := float64(counts["node"+strconv.Itoa(i)])
+		sum += c
+		sq += c * c
+	}
+	mean := sum / 9
+	if cv := math.Sqrt(sq/9-mean*mean) / mean; cv > 0.05 {
+		t.Fatalf("coefficient of variation %.4f too high: %v", cv, counts)
+	}
+}
@@ -1,15 +1,59 @@
 package singleflight
 
-import "sync"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+var (
+	//fn调用了runtime.Goexit时，等待者收到该错误并同样退出
+	errGoexit = errors.New("runtime.Goexit was called")
+)
+
+//
+// PanicError
+// @Description: fn发生panic时传递给所有等待者的值，保留原始的panic值与堆栈
+//
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (p *PanicError) Error() string {
+	return fmt.Sprintf("%v\n\n%s", p.Value, p.Stack)
+}
+
+//
+// Result
+// @Description: DoChan返回的结果，Shared表示结果是否被多个调用方共享
+//
+type Result struct {
+	Val    interface{}
+	Err    error
+	Shared bool
+}
 
 //
 // call
-// @Description: 正在进行中或者已经结束的请求，使用wg锁防止重入
+// @Description: 正在进行中或者已经结束的请求，done关闭后结果可读
 //
 type call struct {
-	wg  sync.WaitGroup
-	val interface{}
-	err error
+	done chan struct{}
+	val  interface{}
+	err  error
+	//fn发生panic时的值
+	panicErr *PanicError
+	//共享本次调用的其余调用方数量
+	dups int
+	//DoChan的调用方
+	chans []chan<- Result
+	//DoContext传给fn的ctx
+	ctx *mergedContext
 }
 
 //
@@ -24,14 +68,16 @@ type Group struct {
 
 //
 // Do
-// @Description: 针对相同的key，保证函数fn只会被调用一次
+// @Description: 针对相同的key，保证函数fn同一时间只会被调用一次，shared表示结果是否被多个调用方共享。
+// fn发生panic时所有等待者都会以*PanicError重新panic
 // @receiver g
 // @param key
 // @param fn
-// @return interface{}
-// @return error
+// @return v
+// @return err
+// @return shared
 //
-func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, error) {
+func (g *Group) Do(key string, fn func() (interface{}, error)) (v interface{}, err error, shared bool) {
 	g.mu.Lock()
 	//懒加载
 	if g.m == nil {
@@ -39,22 +85,353 @@ func (g *Group) Do(key string, fn func() (interface{}, error)) (interface{}, err
 	}
 	//查看是否存在以key为参数的函数调用
 	if c, ok := g.m[key]; ok {
-		//等待调用完毕
-		c.wg.Wait()
-		return c.val, c.err
+		c.dups++
+		//释放锁后再等待，不阻塞其他key的调用
+		g.mu.Unlock()
+		<-c.done
+		return c.result(true)
 	}
 	//第一次进行以key为参数的调用
-	c := new(call)
-	c.wg.Add(1)
+	c := &call{done: make(chan struct{})}
+	g.m[key] = c
+	g.mu.Unlock()
+
+	g.doCall(c, key, fn)
+	return c.result(c.dups > 0)
+}
+
+//
+// DoContext
+// @Description: 与Do相同，但每个调用方可以通过ctx单独放弃等待，放弃时返回ctx.Err()，
+// 共享的调用不受影响，其余调用方仍可拿到结果。fn收到的ctx携带发起者ctx中的值，不随调用方取消，
+// 截止时间为已加入的调用方中最晚的截止时间，任一调用方没有截止时间时fn的ctx也没有截止时间
+// @receiver g
+// @param ctx
+// @param key
+// @param fn
+// @return v
+// @return err
+// @return shared
+//
+func (g *Group) DoContext(ctx context.Context, key string, fn func(ctx context.Context) (interface{}, error)) (v interface{}, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	c, ok := g.m[key]
+	if ok {
+		c.dups++
+		if c.ctx != nil {
+			c.ctx.extend(ctx)
+		}
+	} else {
+		c = &call{done: make(chan struct{}), ctx: newMergedContext(ctx)}
+		g.m[key] = c
+		//在新协程中执行，发起者自身也可以放弃等待
+		go g.doCall(c, key, func() (interface{}, error) {
+			defer c.ctx.finish()
+			return fn(c.ctx)
+		})
+	}
+	g.mu.Unlock()
+
+	select {
+	case <-c.done:
+		g.mu.Lock()
+		shared = ok || c.dups > 0
+		g.mu.Unlock()
+		return c.result(shared)
+	case <-ctx.Done():
+		return nil, ctx.Err(), ok
+	}
+}
+
+//
+// DoManyContext
+// @Description: DoContext的批量版本，keys中已有调用进行中的key等待已有的调用，其余key合并为一次fn调用，
+// 调用期间其余调用方对这些key的Do、DoContext会共享本次结果。fn返回的结果与传入的keys一一对应
+// @receiver g
+// @param ctx
+// @param keys
+// @param fn
+// @return []interface{} 与keys一一对应
+// @return []error 与keys一一对应
+//
+func (g *Group) DoManyContext(ctx context.Context, keys []string, fn func(ctx context.Context, keys []string) ([]interface{}, []error)) ([]interface{}, []error) {
+	calls := make([]*call, len(keys))
+	var (
+		merged   *mergedContext
+		newKeys  []string
+		newCalls []*call
+	)
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	for i, key := range keys {
+		if c, ok := g.m[key]; ok {
+			c.dups++
+			if c.ctx != nil {
+				c.ctx.extend(ctx)
+			}
+			calls[i] = c
+			continue
+		}
+		//本次发起的key共享同一个ctx
+		if merged == nil {
+			merged = newMergedContext(ctx)
+		}
+		c := &call{done: make(chan struct{}), ctx: merged}
+		g.m[key] = c
+		calls[i] = c
+		newKeys = append(newKeys, key)
+		newCalls = append(newCalls, c)
+	}
+	g.mu.Unlock()
+	if len(newKeys) > 0 {
+		go g.doCalls(newKeys, newCalls, func() {
+			defer merged.finish()
+			vals, errs := fn(merged, newKeys)
+			for i, c := range newCalls {
+				if i < len(vals) {
+					c.val = vals[i]
+				}
+				if i < len(errs) {
+					c.err = errs[i]
+				}
+			}
+		})
+	}
+
+	vals := make([]interface{}, len(keys))
+	errs := make([]error, len(keys))
+	for i, c := range calls {
+		select {
+		case <-c.done:
+			vals[i], errs[i], _ = c.result(true)
+		case <-ctx.Done():
+			errs[i] = ctx.Err()
+		}
+	}
+	return vals, errs
+}
+
+//
+// DoChan
+// @Description: 与Do相同，但立即返回一个channel，结果就绪时写入。fn发生panic时Err为*PanicError
+// @receiver g
+// @param key
+// @param fn
+// @return <-chan Result
+//
+func (g *Group) DoChan(key string, fn func() (interface{}, error)) <-chan Result {
+	ch := make(chan Result, 1)
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[string]*call)
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		c.chans = append(c.chans, ch)
+		g.mu.Unlock()
+		return ch
+	}
+	c := &call{done: make(chan struct{}), chans: []chan<- Result{ch}}
 	g.m[key] = c
 	g.mu.Unlock()
 
-	c.val, c.err = fn()
-	c.wg.Done()
+	go g.doCall(c, key, fn)
+	return ch
+}
 
-	//调用完毕，删除正在调用记录
+//
+// Forget
+// @Description: 忘记进行中的key，之后的调用会重新执行fn，不影响已在等待的调用方
+// @receiver g
+// @param key
+//
+func (g *Group) Forget(key string) {
 	g.mu.Lock()
 	delete(g.m, key)
 	g.mu.Unlock()
-	return c.val, c.err
+}
+
+//
+// doCall
+// @Description: 执行fn并记录结果，捕获panic与runtime.Goexit，结束后通知所有等待者
+// @receiver g
+// @param c
+// @param key
+// @param fn
+//
+func (g *Group) doCall(c *call, key string, fn func() (interface{}, error)) {
+	g.doCalls([]string{key}, []*call{c}, func() {
+		c.val, c.err = fn()
+	})
+}
+
+//
+// doCalls
+// @Description: 执行一次fn完成多个key的调用，由fn记录各调用的结果，fn发生panic或调用了runtime.Goexit时所有调用都会收到
+// @receiver g
+// @param keys
+// @param calls 与keys一一对应
+// @param fn
+//
+func (g *Group) doCalls(keys []string, calls []*call, fn func()) {
+	normalReturn := false
+	defer func() {
+		var panicErr *PanicError
+		if !normalReturn {
+			if r := recover(); r != nil {
+				panicErr = &PanicError{Value: r, Stack: debug.Stack()}
+			}
+		}
+		//调用完毕，删除正在调用记录，key可能已被Forget并重新发起
+		g.mu.Lock()
+		for i, c := range calls {
+			if panicErr != nil {
+				c.panicErr = panicErr
+			} else if !normalReturn {
+				c.err = errGoexit
+			}
+			if g.m[keys[i]] == c {
+				delete(g.m, keys[i])
+			}
+			close(c.done)
+			for _, ch := range c.chans {
+				res := Result{Val: c.val, Err: c.err, Shared: c.dups > 0}
+				if c.panicErr != nil {
+					res.Err = c.panicErr
+				}
+				ch <- res
+			}
+		}
+		g.mu.Unlock()
+	}()
+	fn()
+	normalReturn = true
+}
+
+//
+// result
+// @Description: 返回调用结果，fn发生panic或调用了runtime.Goexit时在调用方重现
+// @receiver c
+// @param shared
+// @return interface{}
+// @return error
+// @return bool
+//
+func (c *call) result(shared bool) (interface{}, error, bool) {
+	if c.panicErr != nil {
+		panic(c.panicErr)
+	}
+	if c.err == errGoexit {
+		runtime.Goexit()
+	}
+	return c.val, c.err, shared
+}
+
+//
+// mergedContext
+// @Description: DoContext共享调用使用的ctx，取值来自发起者，不随调用方取消，截止时间随调用方加入而延后
+//
+type mergedContext struct {
+	//只用于取值
+	values   context.Context
+	mu       sync.Mutex
+	deadline time.Time
+	//有调用方没有截止时间
+	unbounded bool
+	timer     *time.Timer
+	done      chan struct{}
+	err       error
+}
+
+func newMergedContext(ctx context.Context) *mergedContext {
+	c := &mergedContext{values: ctx, done: make(chan struct{})}
+	if deadline, ok := ctx.Deadline(); ok {
+		c.deadline = deadline
+		c.timer = time.AfterFunc(time.Until(deadline), c.expire)
+	} else {
+		c.unbounded = true
+	}
+	return c
+}
+
+//
+// extend
+// @Description: 新的调用方加入时延后截止时间
+// @receiver c
+// @param ctx
+//
+func (c *mergedContext) extend(ctx context.Context) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil || c.unbounded {
+		return
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		c.unbounded = true
+		c.deadline = time.Time{}
+		c.timer.Stop()
+		return
+	}
+	if deadline.After(c.deadline) {
+		c.deadline = deadline
+		c.timer.Reset(time.Until(deadline))
+	}
+}
+
+//
+// expire
+// @Description: 到达截止时间时结束ctx，计时器触发后截止时间又被延后时忽略
+// @receiver c
+//
+func (c *mergedContext) expire() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.err != nil || c.unbounded || time.Now().Before(c.deadline) {
+		return
+	}
+	c.err = context.DeadlineExceeded
+	close(c.done)
+}
+
+//
+// finish
+// @Description: fn返回后结束ctx，释放计时器与派生ctx
+// @receiver c
+//
+func (c *mergedContext) finish() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.timer != nil {
+		c.timer.Stop()
+	}
+	if c.err == nil {
+		c.err = context.Canceled
+		close(c.done)
+	}
+}
+
+func (c *mergedContext) Deadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.deadline, !c.deadline.IsZero()
+}
+
+func (c *mergedContext) Done() <-chan struct{} {
+	return c.done
+}
+
+func (c *mergedContext) Err() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.err
+}
+
+func (c *mergedContext) Value(key interface{}) interface{} {
+	return c.values.Value(key)
 }
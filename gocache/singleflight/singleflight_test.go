@@ -0,0 +1,343 @@
+package singleflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDo(t *testing.T) {
+	var g Group
+	v, err, shared := g.Do("key", func() (interface{}, error) {
+		return "bar", nil
+	})
+	if v != "bar" || err != nil || shared {
+		t.Fatalf("Do = %v, %v, %v", v, err, shared)
+	}
+	someErr := errors.New("some error")
+	if _, err, _ = g.Do("key", func() (interface{}, error) {
+		return nil, someErr
+	}); err != someErr {
+		t.Fatalf("Do error = %v; want %v", err, someErr)
+	}
+}
+
+func TestDoDupSuppress(t *testing.T) {
+	var g Group
+	var calls int32
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "bar", nil
+	}
+	const n = 10
+	var wg sync.WaitGroup
+	var shared int32
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err, s := g.Do("key", fn)
+			if v != "bar" || err != nil {
+				t.Errorf("Do = %v, %v", v, err)
+			}
+			if s {
+				atomic.AddInt32(&shared, 1)
+			}
+		}()
+	}
+	//等待其余调用方加入
+	for {
+		g.mu.Lock()
+		c, ok := g.m["key"]
+		dups := 0
+		if ok {
+			dups = c.dups
+		}
+		g.mu.Unlock()
+		if dups == n-1 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+	if calls != 1 || shared != n {
+		t.Fatalf("calls %d shared %d", calls, shared)
+	}
+}
+
+func TestDistinctKeys(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	started := make(chan struct{})
+	go g.Do("slow", func() (interface{}, error) {
+		close(started)
+		<-release
+		return nil, nil
+	})
+	<-started
+	//等待slow的调用方不应阻塞其他key
+	go g.Do("slow", func() (interface{}, error) { return nil, nil })
+	done := make(chan struct{})
+	go func() {
+		g.Do("fast", func() (interface{}, error) { return nil, nil })
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("distinct key blocked by in-flight call")
+	}
+	close(release)
+}
+
+func TestDoChan(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	ch1 := g.DoChan("key", func() (interface{}, error) {
+		<-release
+		return "bar", nil
+	})
+	ch2 := g.DoChan("key", func() (interface{}, error) {
+		return "other", nil
+	})
+	close(release)
+	for _, ch := range []<-chan Result{ch1, ch2} {
+		select {
+		case res := <-ch:
+			if res.Val != "bar" || res.Err != nil || !res.Shared {
+				t.Fatalf("DoChan = %+v", res)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("DoChan timed out")
+		}
+	}
+}
+
+func TestForget(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	started := make(chan struct{})
+	ch := g.DoChan("key", func() (interface{}, error) {
+		close(started)
+		<-release
+		return 1, nil
+	})
+	<-started
+	g.Forget("key")
+	//忘记后重新执行fn
+	if v, _, shared := g.Do("key", func() (interface{}, error) { return 2, nil }); v != 2 || shared {
+		t.Fatalf("expected fresh call after Forget, got %v %v", v, shared)
+	}
+	close(release)
+	if res := <-ch; res.Val != 1 {
+		t.Fatalf("in-flight call should still complete, got %+v", res)
+	}
+}
+
+func TestDoContext(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		<-release
+		//发起者取消后fn的ctx仍然有效
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return "bar", nil
+	}
+	waitDups := func(n int) {
+		for {
+			g.mu.Lock()
+			c, ok := g.m["key"]
+			done := ok && c.dups == n
+			g.mu.Unlock()
+			if done {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		_, err, _ := g.DoContext(ctx, "key", fn)
+		errc <- err
+	}()
+	waitDups(0)
+	res := make(chan interface{}, 1)
+	go func() {
+		v, _, _ := g.DoContext(context.Background(), "key", fn)
+		res <- v
+	}()
+	waitDups(1)
+	//发起者放弃等待，不影响共享的调用
+	cancel()
+	if err := <-errc; err != context.Canceled {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	close(release)
+	select {
+	case v := <-res:
+		if v != "bar" {
+			t.Fatalf("expected shared result, got %v", v)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("waiter did not get result")
+	}
+}
+
+type ctxKey struct{}
+
+func TestDoContextDeadline(t *testing.T) {
+	var g Group
+	started := make(chan context.Context, 1)
+	release := make(chan struct{})
+	fn := func(ctx context.Context) (interface{}, error) {
+		started <- ctx
+		<-release
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+	ctxA, cancelA := context.WithTimeout(context.WithValue(context.Background(), ctxKey{}, "a"), 20*time.Millisecond)
+	defer cancelA()
+	go g.DoContext(ctxA, "key", fn)
+	ctx := <-started
+	deadlineA, _ := ctxA.Deadline()
+	if d, ok := ctx.Deadline(); !ok || !d.Equal(deadlineA) || ctx.Value(ctxKey{}) != "a" {
+		t.Fatalf("expected the caller's deadline and values, got %v %v %v", d, ok, ctx.Value(ctxKey{}))
+	}
+	//后加入的调用方截止时间更晚时延后
+	ctxB, cancelB := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancelB()
+	errB := make(chan error, 1)
+	go func() {
+		_, err, _ := g.DoContext(ctxB, "key", fn)
+		errB <- err
+	}()
+	deadlineB, _ := ctxB.Deadline()
+	for d, _ := ctx.Deadline(); !d.Equal(deadlineB); d, _ = ctx.Deadline() {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if err := ctx.Err(); err != nil {
+		t.Fatalf("expected the extended deadline to keep fn running, got %v", err)
+	}
+	close(release)
+	if err := <-errB; err != context.DeadlineExceeded {
+		t.Fatalf("expected fn to stop at the latest deadline, got %v", err)
+	}
+}
+
+func TestDoManyContext(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	//"a"已有调用进行中
+	resA := make(chan interface{}, 1)
+	go func() {
+		v, _, _ := g.Do("a", func() (interface{}, error) {
+			<-release
+			return "A", nil
+		})
+		resA <- v
+	}()
+	for {
+		g.mu.Lock()
+		_, ok := g.m["a"]
+		g.mu.Unlock()
+		if ok {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	batch := make(chan []string, 1)
+	type result struct {
+		vals []interface{}
+		errs []error
+	}
+	res := make(chan result, 1)
+	go func() {
+		vals, errs := g.DoManyContext(context.Background(), []string{"a", "b", "c"}, func(ctx context.Context, keys []string) ([]interface{}, []error) {
+			batch <- keys
+			<-release
+			return []interface{}{"B", nil}, []error{nil, errors.New("c failed")}
+		})
+		res <- result{vals, errs}
+	}()
+	//进行中的key不重复调用fn
+	if keys := <-batch; len(keys) != 2 || keys[0] != "b" || keys[1] != "c" {
+		t.Fatalf("expected only b and c to be loaded, got %v", keys)
+	}
+	//批量调用期间其余调用方共享结果
+	resB := make(chan interface{}, 1)
+	go func() {
+		v, _, _ := g.DoContext(context.Background(), "b", func(context.Context) (interface{}, error) {
+			return "other", nil
+		})
+		resB <- v
+	}()
+	for {
+		g.mu.Lock()
+		done := g.m["b"].dups == 1
+		g.mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	r := <-res
+	if r.vals[0] != "A" || r.vals[1] != "B" || r.errs[0] != nil || r.errs[1] != nil || r.errs[2] == nil {
+		t.Fatalf("unexpected results %v %v", r.vals, r.errs)
+	}
+	if v := <-resA; v != "A" {
+		t.Fatalf("expected A, got %v", v)
+	}
+	if v := <-resB; v != "B" {
+		t.Fatalf("expected the batch result to be shared, got %v", v)
+	}
+}
+
+func TestPanic(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	fn := func() (interface{}, error) {
+		<-release
+		panic("boom")
+	}
+	ch := g.DoChan("key", fn)
+	recovered := make(chan interface{}, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer func() {
+				recovered <- recover()
+			}()
+			g.Do("key", fn)
+		}()
+	}
+	for {
+		g.mu.Lock()
+		dups := g.m["key"].dups
+		g.mu.Unlock()
+		if dups == 2 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	res := <-ch
+	var pe *PanicError
+	if !errors.As(res.Err, &pe) || pe.Value != "boom" {
+		t.Fatalf("DoChan should receive PanicError, got %+v", res)
+	}
+	for i := 0; i < 2; i++ {
+		if p, ok := (<-recovered).(*PanicError); !ok || p.Value != "boom" {
+			t.Fatalf("expected PanicError in every waiter, got %v", p)
+		}
+	}
+}
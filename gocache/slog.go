@@ -0,0 +1,41 @@
+//go:build go1.21
+
+package gocache
+
+import (
+	"context"
+	"log/slog"
+)
+
+//
+// slogLogger
+// @Description: 将日志交给slog.Logger输出，级别与字段一一对应
+//
+type slogLogger struct {
+	l *slog.Logger
+}
+
+//
+// NewSlogLogger
+// @Description: 使用log/slog输出日志，级别由slog.Handler决定，需要Go 1.21及以上
+// @param l 为nil时使用slog.Default()
+// @return Logger
+//
+func NewSlogLogger(l *slog.Logger) Logger {
+	if l == nil {
+		l = slog.Default()
+	}
+	return slogLogger{l: l}
+}
+
+func (s slogLogger) Enabled(level Level) bool {
+	return s.l.Enabled(context.Background(), slog.Level(level))
+}
+
+func (s slogLogger) Log(level Level, msg string, fields ...Field) {
+	attrs := make([]slog.Attr, len(fields))
+	for i, f := range fields {
+		attrs[i] = slog.Any(f.Key, f.Value)
+	}
+	s.l.LogAttrs(context.Background(), slog.Level(level), msg, attrs...)
+}
@@ -0,0 +1,23 @@
+//go:build go1.21
+
+package gocache
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestSlogLogger(t *testing.T) {
+	var buf bytes.Buffer
+	l := NewSlogLogger(slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelInfo})))
+	if l.Enabled(LevelDebug) || !l.Enabled(LevelWarn) {
+		t.Fatalf("expected levels to follow the handler")
+	}
+	l.Log(LevelWarn, "peer failed", Field{"peer", "a"}, Field{"attempt", 2})
+	got := buf.String()
+	if !strings.Contains(got, "level=WARN") || !strings.Contains(got, `msg="peer failed" peer=a attempt=2`) {
+		t.Fatalf("unexpected output %q", got)
+	}
+}
@@ -0,0 +1,256 @@
+package gocache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+const (
+	//快照文件头的魔数
+	snapshotMagic = "GCSN"
+	//快照格式版本，格式变化时递增
+	snapshotVersion = 1
+	//记录标记，0表示记录结束
+	snapshotEnd   = 0
+	snapshotEntry = 1
+	//单个key或value的长度上限，防止损坏的快照导致分配过大的内存
+	maxSnapshotField = 1 << 30
+)
+
+//
+// ErrCorruptSnapshot
+// @Description: 快照格式错误、版本不支持、校验和不一致或属于其他Group，Restore不会写入任何记录
+//
+var ErrCorruptSnapshot = errors.New("gocache: corrupt snapshot")
+
+//
+// snapshotEntryData
+// @Description: 快照中的一条记录，ttl为写入快照时的剩余存活时间，0表示永不过期
+//
+type snapshotEntryData struct {
+	key   string
+	value []byte
+	ttl   time.Duration
+}
+
+//
+// Snapshot
+// @Description: 将主缓存写入w，格式为：魔数、版本、Group名称，逐条记录的key、value与剩余存活时间，
+// 最后是记录数与CRC32C校验和。记录按淘汰顺序写出，分片数相同时恢复后访问顺序不变，已过期的记录不写出
+// @receiver g
+// @param w
+// @return error
+//
+func (g *Group) Snapshot(w io.Writer) error {
+	sw := &snapshotWriter{w: bufio.NewWriter(w), h: crc32.New(crc32.MakeTable(crc32.Castagnoli))}
+	sw.write([]byte(snapshotMagic))
+	sw.uvarint(snapshotVersion)
+	sw.bytes([]byte(g.name))
+	now := time.Now()
+	count := uint64(0)
+	g.mainCache.rangeEntries(func(key string, value ByteView) bool {
+		var ttl time.Duration
+		if !value.e.IsZero() {
+			if ttl = value.e.Sub(now); ttl <= 0 {
+				return true
+			}
+		}
+		sw.uvarint(snapshotEntry)
+		sw.bytes([]byte(key))
+		sw.bytes(value.b)
+		sw.uvarint(uint64(ttl))
+		count++
+		return sw.err == nil
+	})
+	sw.uvarint(snapshotEnd)
+	sw.uvarint(count)
+	//校验和本身不参与计算
+	sum := sw.h.Sum32()
+	var trailer [4]byte
+	binary.BigEndian.PutUint32(trailer[:], sum)
+	if sw.err == nil {
+		_, sw.err = sw.w.Write(trailer[:])
+	}
+	if sw.err != nil {
+		return sw.err
+	}
+	return sw.w.Flush()
+}
+
+//
+// Restore
+// @Description: 从r读取Snapshot写出的快照并写入主缓存，校验通过后才会写入，写入时剩余存活时间从当前时刻起算
+// @receiver g
+// @param r
+// @return error
+//
+func (g *Group) Restore(r io.Reader) error {
+	entries, err := readSnapshot(r, g.name)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, e := range entries {
+		value := ByteView{b: e.value, l: now}
+		if e.ttl > 0 {
+			value.e = now.Add(e.ttl)
+		}
+		g.populateCache(e.key, value)
+	}
+	return nil
+}
+
+//
+// readSnapshot
+// @Description: 解析快照并校验版本、Group名称、记录数与校验和
+// @param r
+// @param name
+// @return []snapshotEntryData
+// @return error
+//
+func readSnapshot(r io.Reader, name string) ([]snapshotEntryData, error) {
+	sr := &snapshotReader{r: bufio.NewReader(r), h: crc32.New(crc32.MakeTable(crc32.Castagnoli))}
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(sr, magic); err != nil || string(magic) != snapshotMagic {
+		return nil, fmt.Errorf("%w: bad magic", ErrCorruptSnapshot)
+	}
+	version, err := binary.ReadUvarint(sr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+	if version != snapshotVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrCorruptSnapshot, version)
+	}
+	group, err := sr.bytes()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+	}
+	if string(group) != name {
+		return nil, fmt.Errorf("%w: snapshot of group %s", ErrCorruptSnapshot, group)
+	}
+	var entries []snapshotEntryData
+	for {
+		flag, err := binary.ReadUvarint(sr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+		}
+		if flag == snapshotEnd {
+			break
+		}
+		if flag != snapshotEntry {
+			return nil, fmt.Errorf("%w: unknown record %d", ErrCorruptSnapshot, flag)
+		}
+		key, err := sr.bytes()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+		}
+		value, err := sr.bytes()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+		}
+		ttl, err := binary.ReadUvarint(sr)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorruptSnapshot, err)
+		}
+		entries = append(entries, snapshotEntryData{key: string(key), value: value, ttl: time.Duration(ttl)})
+	}
+	count, err := binary.ReadUvarint(sr)
+	if err != nil || count != uint64(len(entries)) {
+		return nil, fmt.Errorf("%w: record count mismatch", ErrCorruptSnapshot)
+	}
+	sum := sr.h.Sum32()
+	var trailer [4]byte
+	if _, err := io.ReadFull(sr.r, trailer[:]); err != nil {
+		return nil, fmt.Errorf("%w: missing checksum", ErrCorruptSnapshot)
+	}
+	if binary.BigEndian.Uint32(trailer[:]) != sum {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrCorruptSnapshot)
+	}
+	return entries, nil
+}
+
+//
+// snapshotWriter
+// @Description: 写入的同时计算校验和，出错后忽略后续写入，由调用方统一检查err
+//
+type snapshotWriter struct {
+	w   *bufio.Writer
+	h   hash.Hash32
+	err error
+	buf [binary.MaxVarintLen64]byte
+}
+
+func (s *snapshotWriter) write(p []byte) {
+	if s.err != nil {
+		return
+	}
+	s.h.Write(p)
+	_, s.err = s.w.Write(p)
+}
+
+func (s *snapshotWriter) uvarint(v uint64) {
+	n := binary.PutUvarint(s.buf[:], v)
+	s.write(s.buf[:n])
+}
+
+//
+// bytes
+// @Description: 写入长度前缀与内容
+// @receiver s
+// @param p
+//
+func (s *snapshotWriter) bytes(p []byte) {
+	s.uvarint(uint64(len(p)))
+	s.write(p)
+}
+
+//
+// snapshotReader
+// @Description: 读取的同时计算校验和
+//
+type snapshotReader struct {
+	r *bufio.Reader
+	h hash.Hash32
+}
+
+func (s *snapshotReader) Read(p []byte) (int, error) {
+	n, err := s.r.Read(p)
+	s.h.Write(p[:n])
+	return n, err
+}
+
+func (s *snapshotReader) ReadByte() (byte, error) {
+	b, err := s.r.ReadByte()
+	if err == nil {
+		s.h.Write([]byte{b})
+	}
+	return b, err
+}
+
+//
+// bytes
+// @Description: 读取长度前缀与内容
+// @receiver s
+// @return []byte
+// @return error
+//
+func (s *snapshotReader) bytes() ([]byte, error) {
+	n, err := binary.ReadUvarint(s)
+	if err != nil {
+		return nil, err
+	}
+	if n > maxSnapshotField {
+		return nil, fmt.Errorf("field too large: %d", n)
+	}
+	p := make([]byte, n)
+	if _, err = io.ReadFull(s, p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
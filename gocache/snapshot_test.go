@@ -0,0 +1,107 @@
+package gocache
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newSnapshotGroup(name string, cacheBytes int64) *Group {
+	return NewGroup(name, cacheBytes, TTLGetterFunc(
+		func(_ context.Context, key string) ([]byte, time.Duration, error) {
+			if key == "forever" {
+				return []byte("v-" + key), 0, nil
+			}
+			if key == "short" {
+				return []byte("v-" + key), 20 * time.Millisecond, nil
+			}
+			return []byte("v-" + key), time.Hour, nil
+		}))
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	//k0至k3每条占6字节，short占12字节
+	g := newSnapshotGroup("snapshot", 36)
+	for i := 0; i < 4; i++ {
+		g.Get("k" + strconv.Itoa(i))
+	}
+	g.Get("short")
+	//k0变为最近访问
+	g.Get("k0")
+	time.Sleep(30 * time.Millisecond)
+
+	var buf bytes.Buffer
+	if err := g.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	//恢复后只剩k0至k3，再写入一条即触发淘汰
+	restored := newSnapshotGroup("snapshot", 26)
+	if err := restored.Restore(bytes.NewReader(buf.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if n := restored.mainCache.stats().Items; n != 4 {
+		t.Fatalf("expected 4 restored items without the expired one, got %d", n)
+	}
+	v, ok := restored.mainCache.get("k2")
+	if !ok || v.String() != "v-k2" {
+		t.Fatalf("unexpected restored value %q", v.String())
+	}
+	if ttl := time.Until(v.Expire()); ttl < 59*time.Minute || ttl > time.Hour {
+		t.Fatalf("expected remaining ttl to be kept, got %v", ttl)
+	}
+	//访问顺序还原后，最久未访问的k1最先被淘汰
+	restored.populateCache("k9", ByteView{b: []byte("xx")})
+	if _, ok := restored.mainCache.get("k1"); ok {
+		t.Fatalf("expected least recently used k1 to be evicted first")
+	}
+	for _, key := range []string{"k0", "k3"} {
+		if _, ok := restored.mainCache.get(key); !ok {
+			t.Fatalf("expected %s to survive eviction", key)
+		}
+	}
+}
+
+func TestSnapshotCorrupt(t *testing.T) {
+	g := newSnapshotGroup("snapshot-corrupt", 2<<10)
+	g.Get("forever")
+	g.Get("k")
+	var buf bytes.Buffer
+	if err := g.Snapshot(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	flipped := append([]byte(nil), data...)
+	flipped[len(flipped)/2] ^= 0xff
+	version := append([]byte(nil), data...)
+	version[len(snapshotMagic)] = snapshotVersion + 1
+	for name, snapshot := range map[string][]byte{
+		"flipped":   flipped,
+		"truncated": data[:len(data)-1],
+		"version":   version,
+		"empty":     nil,
+	} {
+		restored := newSnapshotGroup("snapshot-corrupt", 2<<10)
+		if err := restored.Restore(bytes.NewReader(snapshot)); !errors.Is(err, ErrCorruptSnapshot) {
+			t.Fatalf("%s: expected corrupt snapshot error, got %v", name, err)
+		}
+		if n := restored.mainCache.stats().Items; n != 0 {
+			t.Fatalf("%s: corrupt snapshot should not restore any item, got %d", name, n)
+		}
+	}
+
+	other := newSnapshotGroup("snapshot-other", 2<<10)
+	if err := other.Restore(bytes.NewReader(data)); !errors.Is(err, ErrCorruptSnapshot) {
+		t.Fatalf("expected snapshot of another group to be rejected, got %v", err)
+	}
+	restored := newSnapshotGroup("snapshot-corrupt", 2<<10)
+	if err := restored.Restore(bytes.NewReader(data)); err != nil {
+		t.Fatal(err)
+	}
+	if v, ok := restored.mainCache.get("forever"); !ok || !v.Expire().IsZero() {
+		t.Fatalf("expected value without ttl to be restored without expiration")
+	}
+}
@@ -0,0 +1,197 @@
+package gocache
+
+import (
+	"errors"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+//
+// AtomicInt
+// @Description: 并发安全的计数器
+//
+type AtomicInt int64
+
+func (i *AtomicInt) Add(n int64) {
+	atomic.AddInt64((*int64)(i), n)
+}
+
+func (i *AtomicInt) Get() int64 {
+	return atomic.LoadInt64((*int64)(i))
+}
+
+func (i *AtomicInt) String() string {
+	return strconv.FormatInt(i.Get(), 10)
+}
+
+//
+// groupStats
+// @Description: Group内部的计数器
+//
+type groupStats struct {
+	//Get调用次数
+	gets AtomicInt
+	//主缓存与热点缓存命中次数
+	cacheHits AtomicInt
+	//其中热点缓存命中次数
+	hotHits AtomicInt
+	//负缓存命中次数
+	negativeHits AtomicInt
+	//返回过期旧值的次数
+	staleHits AtomicInt
+	//启动后台刷新的次数
+	refreshes AtomicInt
+	//缓存未命中后的加载次数
+	loads AtomicInt
+	//经singleflight合并后实际执行的加载次数
+	loadsDeduped AtomicInt
+	//从远程节点加载成功与失败的次数
+	peerLoads  AtomicInt
+	peerErrors AtomicInt
+	//本地回调加载成功与失败的次数
+	localLoads    AtomicInt
+	localLoadErrs AtomicInt
+	//收到远程节点请求的次数
+	serverRequests AtomicInt
+	//节点变更后交接给新归属节点的条数
+	handoffs AtomicInt
+	//二级缓存命中次数与写入二级缓存的条数
+	l2Hits   AtomicInt
+	l2Spills AtomicInt
+}
+
+//
+// GroupStats
+// @Description: Group统计信息的快照
+//
+type GroupStats struct {
+	Gets           int64
+	CacheHits      int64
+	HotHits        int64
+	NegativeHits   int64
+	StaleHits      int64
+	Refreshes      int64
+	Loads          int64
+	LoadsDeduped   int64
+	PeerLoads      int64
+	PeerErrors     int64
+	LocalLoads     int64
+	LocalLoadErrs  int64
+	ServerRequests int64
+	Handoffs       int64
+	L2Hits         int64
+	L2Spills       int64
+	MainCache      CacheStats
+	HotCache       CacheStats
+	NegativeCache  CacheStats
+}
+
+//
+// Stats
+// @Description: 返回Group统计信息的快照
+// @receiver g
+// @return GroupStats
+//
+func (g *Group) Stats() GroupStats {
+	return GroupStats{
+		Gets:           g.stats.gets.Get(),
+		CacheHits:      g.stats.cacheHits.Get(),
+		HotHits:        g.stats.hotHits.Get(),
+		NegativeHits:   g.stats.negativeHits.Get(),
+		StaleHits:      g.stats.staleHits.Get(),
+		Refreshes:      g.stats.refreshes.Get(),
+		Loads:          g.stats.loads.Get(),
+		LoadsDeduped:   g.stats.loadsDeduped.Get(),
+		PeerLoads:      g.stats.peerLoads.Get(),
+		PeerErrors:     g.stats.peerErrors.Get(),
+		LocalLoads:     g.stats.localLoads.Get(),
+		LocalLoadErrs:  g.stats.localLoadErrs.Get(),
+		ServerRequests: g.stats.serverRequests.Get(),
+		Handoffs:       g.stats.handoffs.Get(),
+		L2Hits:         g.stats.l2Hits.Get(),
+		L2Spills:       g.stats.l2Spills.Get(),
+		MainCache:      g.mainCache.stats(),
+		HotCache:       g.hotCache.stats(),
+		NegativeCache:  g.negativeCache.stats(),
+	}
+}
+
+//
+// peerStats
+// @Description: 客户端视角下单个远程节点的请求统计
+//
+type peerStats struct {
+	requests AtomicInt
+	errors   AtomicInt
+	//请求耗时累计，单位纳秒
+	latency AtomicInt
+	//请求耗时最大值，单位纳秒
+	maxLatency AtomicInt
+	//请求耗时分布
+	hist histogram
+	//进行中的请求数，作为有界负载一致性哈希的节点负载
+	inflight AtomicInt
+}
+
+//
+// PeerStats
+// @Description: 单个远程节点请求统计的快照
+//
+type PeerStats struct {
+	Requests   int64
+	Errors     int64
+	AvgLatency time.Duration
+	MaxLatency time.Duration
+	InFlight   int64
+}
+
+//
+// begin
+// @Description: 标记一次请求开始，返回开始时间，请求结束时需调用record
+// @receiver s
+// @return time.Time
+//
+func (s *peerStats) begin() time.Time {
+	s.inflight.Add(1)
+	return time.Now()
+}
+
+//
+// record
+// @Description: 记录一次请求的耗时与结果
+// @receiver s
+// @param start
+// @param err
+//
+func (s *peerStats) record(start time.Time, err error) {
+	s.inflight.Add(-1)
+	elapsed := time.Since(start)
+	d := int64(elapsed)
+	s.hist.observe(elapsed)
+	s.requests.Add(1)
+	s.latency.Add(d)
+	//key不存在是正常应答，不计入节点错误
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		s.errors.Add(1)
+	}
+	for {
+		max := s.maxLatency.Get()
+		if d <= max || atomic.CompareAndSwapInt64((*int64)(&s.maxLatency), max, d) {
+			return
+		}
+	}
+}
+
+func (s *peerStats) snapshot() PeerStats {
+	stats := PeerStats{
+		Requests:   s.requests.Get(),
+		Errors:     s.errors.Get(),
+		MaxLatency: time.Duration(s.maxLatency.Get()),
+		InFlight:   s.inflight.Get(),
+	}
+	if stats.Requests > 0 {
+		stats.AvgLatency = time.Duration(s.latency.Get() / stats.Requests)
+	}
+	return stats
+}
@@ -0,0 +1,108 @@
+package tinylfu
+
+const (
+	//每个key在sketch中占用的行数
+	sketchDepth = 4
+	//计数器上限，相当于4bit计数器
+	maxCount = 15
+	//累计写入达到宽度的resetFactor倍时计数减半
+	resetFactor = 10
+)
+
+//
+// sketch
+// @Description: 带衰减的count-min sketch，估算key最近的访问频次
+//
+type sketch struct {
+	rows [sketchDepth][]uint8
+	mask uint32
+	//自上次衰减以来的写入次数
+	additions int
+	//触发衰减的写入次数
+	sampleSize int
+}
+
+//
+// newSketch
+// @Description: 实例化sketch，宽度向上取整为2的幂
+// @param width
+// @return *sketch
+//
+func newSketch(width int) *sketch {
+	w := 1
+	for w < width {
+		w <<= 1
+	}
+	s := &sketch{mask: uint32(w - 1), sampleSize: resetFactor * w}
+	for i := range s.rows {
+		s.rows[i] = make([]uint8, w)
+	}
+	return s
+}
+
+//
+// index
+// @Description: 双重哈希计算第i行的下标
+// @receiver s
+// @param h
+// @param i
+// @return uint32
+//
+func (s *sketch) index(h uint64, i int) uint32 {
+	h1, h2 := uint32(h), uint32(h>>32)
+	return (h1 + uint32(i)*h2) & s.mask
+}
+
+//
+// increment
+// @Description: 记录一次访问，计数饱和后不再增加，写入次数达到sampleSize时整体衰减
+// @receiver s
+// @param h
+//
+func (s *sketch) increment(h uint64) {
+	added := false
+	for i := range s.rows {
+		idx := s.index(h, i)
+		if s.rows[i][idx] < maxCount {
+			s.rows[i][idx]++
+			added = true
+		}
+	}
+	if added {
+		s.additions++
+		if s.additions >= s.sampleSize {
+			s.reset()
+		}
+	}
+}
+
+//
+// estimate
+// @Description: 返回各行计数的最小值作为频次估计
+// @receiver s
+// @param h
+// @return uint8
+//
+func (s *sketch) estimate(h uint64) uint8 {
+	min := uint8(maxCount)
+	for i := range s.rows {
+		if v := s.rows[i][s.index(h, i)]; v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+//
+// reset
+// @Description: 所有计数减半，让历史热点逐渐让位于新的热点
+// @receiver s
+//
+func (s *sketch) reset() {
+	for i := range s.rows {
+		for j := range s.rows[i] {
+			s.rows[i][j] >>= 1
+		}
+	}
+	s.additions /= 2
+}
@@ -0,0 +1,328 @@
+package tinylfu
+
+import (
+	"container/list"
+	"gocache/internal/fnv1a"
+	"gocache/lru"
+	"time"
+)
+
+type Value = lru.Value
+
+const (
+	//窗口LRU占maxBytes的比例
+	windowRatio = 0.01
+	//保护段占主缓存的比例
+	protectedRatio = 0.8
+	//估算条数时假定的平均记录大小，用于确定sketch宽度
+	averageEntryBytes = 64
+	minSketchWidth    = 1 << 10
+	maxSketchWidth    = 1 << 20
+)
+
+//
+// Cache
+// @Description: W-TinyLFU缓存，新记录先进入窗口LRU，被窗口淘汰后作为候选者与主缓存的淘汰者比较访问频次，
+// 频次更高者留下，一次性访问的数据无法挤掉热点数据。主缓存为分段LRU，分为试用段与保护段
+//
+type Cache struct {
+	//允许使用的最大内存
+	maxBytes int64
+	//当前已使用内存
+	nbytes int64
+	//窗口LRU与主缓存保护段的容量，单位字节
+	windowMax, protectedMax int64
+	//window为窗口LRU，probation与protected为主缓存的试用段与保护段，队首均为最近访问
+	window, probation, protected *queue
+	//访问频次估计
+	sketch *sketch
+	cache  map[string]*list.Element
+	//某条记录被移除时的回调函数
+	OnEvicted func(key string, value Value)
+}
+
+//
+// queue
+// @Description: 带字节统计的LRU队列
+//
+type queue struct {
+	ll    *list.List
+	bytes int64
+}
+
+func newQueue() *queue {
+	return &queue{ll: list.New()}
+}
+
+type entry struct {
+	key   string
+	value Value
+	//过期时间，零值表示永不过期
+	expire time.Time
+	size   int64
+	hash   uint64
+	//所在队列
+	queue *queue
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+//
+// New
+// @Description: 实例化Cache
+// @param maxBytes
+// @param OnEvicted
+// @return *Cache
+//
+func New(maxBytes int64, OnEvicted func(string, Value)) *Cache {
+	width := maxSketchWidth
+	if maxBytes > 0 && maxBytes/averageEntryBytes < maxSketchWidth {
+		width = int(maxBytes / averageEntryBytes)
+	}
+	if width < minSketchWidth {
+		width = minSketchWidth
+	}
+	windowMax := int64(float64(maxBytes) * windowRatio)
+	return &Cache{
+		maxBytes:     maxBytes,
+		windowMax:    windowMax,
+		protectedMax: int64(float64(maxBytes-windowMax) * protectedRatio),
+		window:       newQueue(),
+		probation:    newQueue(),
+		protected:    newQueue(),
+		sketch:       newSketch(width),
+		cache:        make(map[string]*list.Element),
+		OnEvicted:    OnEvicted,
+	}
+}
+
+//
+// Get
+// @Description: 查找，无论是否命中都记录一次访问频次
+// @receiver c
+// @param key
+// @return value
+// @return ok
+//
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	ele, ok := c.cache[key]
+	if !ok {
+		c.sketch.increment(fnv1a.Sum64(key))
+		return nil, false
+	}
+	kv := ele.Value.(*entry)
+	c.sketch.increment(kv.hash)
+	//惰性过期，访问时发现过期直接删除
+	if kv.expired(time.Now()) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	c.access(ele)
+	return kv.value, true
+}
+
+//
+// access
+// @Description: 命中后调整位置，试用段的记录晋升至保护段
+// @receiver c
+// @param ele
+//
+func (c *Cache) access(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	if kv.queue != c.probation {
+		kv.queue.ll.MoveToFront(ele)
+		return
+	}
+	c.move(ele, c.protected)
+	//保护段超出容量时将最久未访问的记录降级回试用段
+	for c.maxBytes != 0 && c.protected.bytes > c.protectedMax && c.protected.ll.Len() > 1 {
+		c.move(c.protected.ll.Back(), c.probation)
+	}
+}
+
+func (c *Cache) move(ele *list.Element, to *queue) {
+	kv := ele.Value.(*entry)
+	kv.queue.ll.Remove(ele)
+	kv.queue.bytes -= kv.size
+	c.push(kv, to)
+}
+
+func (c *Cache) push(kv *entry, to *queue) {
+	kv.queue = to
+	to.bytes += kv.size
+	c.cache[kv.key] = to.ll.PushFront(kv)
+}
+
+//
+// RemoveOldest
+// @Description: 删除策略，依次从试用段、保护段、窗口的队尾淘汰一条记录
+// @receiver c
+//
+func (c *Cache) RemoveOldest() {
+	for _, q := range []*queue{c.probation, c.protected, c.window} {
+		if ele := q.ll.Back(); ele != nil {
+			c.removeElement(ele)
+			return
+		}
+	}
+}
+
+//
+// Add
+// @Description: 添加
+// @receiver c
+// @param key
+// @param value
+//
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+//
+// AddWithExpire
+// @Description: 添加带过期时间的缓存，expire为零值表示永不过期，新记录进入窗口LRU，更新已有记录视为一次访问
+// @receiver c
+// @param key
+// @param value
+// @param expire
+//
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	size := int64(len(key)) + int64(value.Len())
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		c.nbytes += size - kv.size
+		kv.queue.bytes += size - kv.size
+		kv.value, kv.expire, kv.size = value, expire, size
+		c.sketch.increment(kv.hash)
+		c.access(ele)
+	} else {
+		c.push(&entry{key: key, value: value, expire: expire, size: size, hash: fnv1a.Sum64(key)}, c.window)
+		c.nbytes += size
+	}
+	c.evict()
+}
+
+//
+// evict
+// @Description: 窗口超出容量时将窗口淘汰的记录作为候选者放入试用段，再按频次决定淘汰候选者还是试用段的记录
+// @receiver c
+//
+func (c *Cache) evict() {
+	if c.maxBytes == 0 {
+		return
+	}
+	for c.window.bytes > c.windowMax && c.window.ll.Len() > 0 {
+		candidate := c.window.ll.Back()
+		c.move(candidate, c.probation)
+		c.admit(candidate)
+	}
+	for c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+//
+// admit
+// @Description: 候选者的访问频次高于淘汰者时淘汰后者，否则淘汰候选者，频次相同时保留已有记录
+// @receiver c
+// @param candidate
+//
+func (c *Cache) admit(candidate *list.Element) {
+	cand := candidate.Value.(*entry)
+	for c.maxBytes < c.nbytes {
+		victim := c.probation.ll.Back()
+		if victim == candidate {
+			victim = c.protected.ll.Back()
+		}
+		if victim == nil {
+			return
+		}
+		if c.sketch.estimate(cand.hash) <= c.sketch.estimate(victim.Value.(*entry).hash) {
+			c.removeElement(candidate)
+			return
+		}
+		c.removeElement(victim)
+	}
+}
+
+//
+// Remove
+// @Description: 删除指定key的缓存，返回是否存在
+// @receiver c
+// @param key
+// @return bool
+//
+func (c *Cache) Remove(key string) bool {
+	if ele, ok := c.cache[key]; ok {
+		c.removeElement(ele)
+		return true
+	}
+	return false
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	kv.queue.ll.Remove(ele)
+	kv.queue.bytes -= kv.size
+	delete(c.cache, kv.key)
+	c.nbytes -= kv.size
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+//
+// RemoveExpired
+// @Description: 清理所有已过期的缓存，返回清理的条数
+// @receiver c
+// @return int
+//
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	removed := 0
+	for _, q := range []*queue{c.window, c.probation, c.protected} {
+		for ele := q.ll.Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*entry).expired(now) {
+				c.removeElement(ele)
+				removed++
+			}
+			ele = prev
+		}
+	}
+	return removed
+}
+
+//
+// Range
+// @Description: 按淘汰顺序依次遍历试用段、保护段与窗口，各段从最久未访问到最近访问，跳过已过期的记录，不改变访问顺序，fn返回false时停止
+// @receiver c
+// @param fn
+//
+func (c *Cache) Range(fn func(key string, value Value, expire time.Time) bool) {
+	now := time.Now()
+	for _, q := range []*queue{c.probation, c.protected, c.window} {
+		for ele := q.ll.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			if !kv.expired(now) && !fn(kv.key, kv.value, kv.expire) {
+				return
+			}
+		}
+	}
+}
+
+//
+// Bytes
+// @Description: 当前已使用内存
+// @receiver c
+// @return int64
+//
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+func (c *Cache) Len() int {
+	return len(c.cache)
+}
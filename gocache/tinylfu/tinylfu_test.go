@@ -0,0 +1,189 @@
+package tinylfu
+
+import (
+	"gocache/internal/fnv1a"
+	"gocache/lru"
+	"math/rand"
+	"strconv"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestSketch(t *testing.T) {
+	s := newSketch(16)
+	h := fnv1a.Sum64("key")
+	for i := 0; i < 20; i++ {
+		s.increment(h)
+	}
+	if n := s.estimate(h); n != maxCount {
+		t.Fatalf("expected saturated count %d, got %d", maxCount, n)
+	}
+	s.reset()
+	if n := s.estimate(h); n != maxCount/2 {
+		t.Fatalf("expected halved count, got %d", n)
+	}
+	//写入次数达到sampleSize时自动衰减
+	for i := 0; i < s.sampleSize; i++ {
+		s.increment(fnv1a.Sum64(strconv.Itoa(i)))
+	}
+	if s.additions >= s.sampleSize {
+		t.Fatalf("sketch was not aged, additions %d", s.additions)
+	}
+}
+
+func TestAdmission(t *testing.T) {
+	c := New(1000, nil)
+	for round := 0; round < 5; round++ {
+		for i := 0; i < 10; i++ {
+			key := "hot" + strconv.Itoa(i)
+			if _, ok := c.Get(key); !ok {
+				c.Add(key, String("0123456789012345"))
+			}
+		}
+	}
+	//大量只访问一次的数据不会挤掉热点数据
+	for i := 0; i < 1000; i++ {
+		key := "once" + strconv.Itoa(i)
+		if _, ok := c.Get(key); !ok {
+			c.Add(key, String("0123456789012345"))
+		}
+	}
+	for i := 0; i < 10; i++ {
+		if _, ok := c.Get("hot" + strconv.Itoa(i)); !ok {
+			t.Fatalf("hot key %d evicted by one-hit wonders", i)
+		}
+	}
+	if c.Bytes() > 1000 {
+		t.Fatalf("bytes %d exceeds limit", c.Bytes())
+	}
+}
+
+func TestRemove(t *testing.T) {
+	evicted := make([]string, 0)
+	c := New(0, func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	c.Add("key1", String("1234"))
+	c.Add("key2", String("5678"))
+	c.Add("key2", String("56"))
+	if !c.Remove("key1") || c.Remove("key1") {
+		t.Fatalf("remove should report existence")
+	}
+	if c.Len() != 1 || c.Bytes() != int64(len("key2")+len("56")) {
+		t.Fatalf("unexpected len %d bytes %d", c.Len(), c.Bytes())
+	}
+	if len(evicted) != 1 || evicted[0] != "key1" {
+		t.Fatalf("OnEvicted not called, got %v", evicted)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	c := New(0, nil)
+	c.AddWithExpire("key1", String("1234"), time.Now().Add(-time.Second))
+	c.AddWithExpire("key2", String("5678"), time.Now().Add(time.Hour))
+	c.Add("key3", String("9"))
+	if _, ok := c.Get("key1"); ok || c.Len() != 2 {
+		t.Fatalf("expired key1 should be removed lazily")
+	}
+	c.AddWithExpire("key2", String("5678"), time.Now().Add(-time.Second))
+	if n := c.RemoveExpired(); n != 1 || c.Len() != 1 {
+		t.Fatalf("expected 1 expired entry removed, got %d", n)
+	}
+	if _, ok := c.Get("key3"); !ok {
+		t.Fatalf("key3 should never expire")
+	}
+}
+
+//
+// policy
+// @Description: 命中率对比所需的最小接口
+//
+type policy interface {
+	Get(key string) (Value, bool)
+	Add(key string, value Value)
+}
+
+//
+// zipfTrace
+// @Description: 生成服从Zipf分布的访问序列
+// @param n
+// @param seed
+// @return []string
+//
+func zipfTrace(n int, seed int64) []string {
+	r := rand.New(rand.NewSource(seed))
+	z := rand.NewZipf(r, 1.01, 1, 1<<16)
+	trace := make([]string, n)
+	for i := range trace {
+		trace[i] = "key" + strconv.FormatUint(z.Uint64(), 10)
+	}
+	return trace
+}
+
+//
+// hitRatio
+// @Description: 按访问序列回放，未命中时写入，返回命中率
+// @param c
+// @param trace
+// @return float64
+//
+func hitRatio(c policy, trace []string) float64 {
+	hits := 0
+	for _, key := range trace {
+		if _, ok := c.Get(key); ok {
+			hits++
+			continue
+		}
+		c.Add(key, String("0123456789012345"))
+	}
+	return float64(hits) / float64(len(trace))
+}
+
+func TestHitRatio(t *testing.T) {
+	trace := zipfTrace(200000, 1)
+	//约容纳1000条记录
+	maxBytes := int64(1000 * 25)
+	lruRatio := hitRatio(lru.New(maxBytes, nil), trace)
+	tinyRatio := hitRatio(New(maxBytes, nil), trace)
+	t.Logf("lru %.4f tinylfu %.4f", lruRatio, tinyRatio)
+	if tinyRatio <= lruRatio {
+		t.Fatalf("expected tinylfu hit ratio %.4f above lru %.4f", tinyRatio, lruRatio)
+	}
+}
+
+func benchmarkHitRatio(b *testing.B, newPolicy func(maxBytes int64) policy) {
+	trace := zipfTrace(1<<16, 1)
+	for _, entries := range []int64{100, 1000, 10000} {
+		b.Run(strconv.FormatInt(entries, 10), func(b *testing.B) {
+			c := newPolicy(entries * 25)
+			hits := 0
+			for i := 0; i < b.N; i++ {
+				key := trace[i&(len(trace)-1)]
+				if _, ok := c.Get(key); ok {
+					hits++
+					continue
+				}
+				c.Add(key, String("0123456789012345"))
+			}
+			b.ReportMetric(float64(hits)/float64(b.N)*100, "hit%")
+		})
+	}
+}
+
+func BenchmarkHitRatioLRU(b *testing.B) {
+	benchmarkHitRatio(b, func(maxBytes int64) policy {
+		return lru.New(maxBytes, nil)
+	})
+}
+
+func BenchmarkHitRatioTinyLFU(b *testing.B) {
+	benchmarkHitRatio(b, func(maxBytes int64) policy {
+		return New(maxBytes, nil)
+	})
+}
@@ -0,0 +1,281 @@
+package twoq
+
+import (
+	"container/list"
+	"gocache/lru"
+	"time"
+)
+
+type Value = lru.Value
+
+const (
+	//a1in占maxBytes的比例
+	recentRatio = 0.25
+	//a1out幽灵队列的容量占maxBytes的比例
+	ghostRatio = 0.5
+)
+
+//
+// Cache
+// @Description: 2Q缓存，新记录先进入FIFO队列a1in，从a1in淘汰后key进入幽灵队列a1out，
+// 再次写入时才进入LRU队列am，一次性扫描的数据不会冲刷掉am中的热点数据
+//
+type Cache struct {
+	//允许使用的最大内存
+	maxBytes int64
+	//当前已使用内存
+	nbytes int64
+	//a1in为FIFO队列，am为LRU队列，队首均为最新
+	a1in, am *queue
+	//a1in淘汰记录的幽灵队列，只保存key与淘汰前的大小
+	a1out *queue
+	cache map[string]*list.Element
+	//某条记录被移除时的回调函数
+	OnEvicted func(key string, value Value)
+}
+
+//
+// queue
+// @Description: 带字节统计的队列
+//
+type queue struct {
+	ll    *list.List
+	bytes int64
+}
+
+func newQueue() *queue {
+	return &queue{ll: list.New()}
+}
+
+type entry struct {
+	key   string
+	value Value
+	//过期时间，零值表示永不过期
+	expire time.Time
+	//记录大小，幽灵记录保留淘汰前的大小
+	size int64
+	//所在队列
+	queue *queue
+}
+
+func (e *entry) expired(now time.Time) bool {
+	return !e.expire.IsZero() && !now.Before(e.expire)
+}
+
+//
+// New
+// @Description: 实例化Cache
+// @param maxBytes
+// @param OnEvicted
+// @return *Cache
+//
+func New(maxBytes int64, OnEvicted func(string, Value)) *Cache {
+	return &Cache{
+		maxBytes:  maxBytes,
+		a1in:      newQueue(),
+		am:        newQueue(),
+		a1out:     newQueue(),
+		cache:     make(map[string]*list.Element),
+		OnEvicted: OnEvicted,
+	}
+}
+
+//
+// Get
+// @Description: 查找，am中命中的记录移至队首，a1in中命中的记录保持FIFO顺序
+// @receiver c
+// @param key
+// @return value
+// @return ok
+//
+func (c *Cache) Get(key string) (value Value, ok bool) {
+	ele, ok := c.cache[key]
+	if !ok {
+		return nil, false
+	}
+	kv := ele.Value.(*entry)
+	if kv.queue == c.a1out {
+		return nil, false
+	}
+	//惰性过期，访问时发现过期直接删除
+	if kv.expired(time.Now()) {
+		c.removeElement(ele)
+		return nil, false
+	}
+	if kv.queue == c.am {
+		c.am.ll.MoveToFront(ele)
+	}
+	return kv.value, true
+}
+
+//
+// RemoveOldest
+// @Description: 删除策略，a1in超出其容量时淘汰a1in队尾并记入a1out，否则淘汰am队尾
+// @receiver c
+//
+func (c *Cache) RemoveOldest() {
+	from := c.am
+	if c.a1in.ll.Len() > 0 && (float64(c.a1in.bytes) > float64(c.maxBytes)*recentRatio || c.am.ll.Len() == 0) {
+		from = c.a1in
+	}
+	ele := from.ll.Back()
+	if ele == nil {
+		return
+	}
+	kv := ele.Value.(*entry)
+	c.removeElement(ele)
+	if from == c.a1in {
+		c.push(&entry{key: kv.key, size: kv.size}, c.a1out)
+		for float64(c.a1out.bytes) > float64(c.maxBytes)*ghostRatio {
+			c.drop(c.a1out.ll.Back())
+		}
+	}
+}
+
+//
+// Add
+// @Description: 添加
+// @receiver c
+// @param key
+// @param value
+//
+func (c *Cache) Add(key string, value Value) {
+	c.AddWithExpire(key, value, time.Time{})
+}
+
+//
+// AddWithExpire
+// @Description: 添加带过期时间的缓存，expire为零值表示永不过期，
+// 新记录进入a1in，命中a1out的记录进入am
+// @receiver c
+// @param key
+// @param value
+// @param expire
+//
+func (c *Cache) AddWithExpire(key string, value Value, expire time.Time) {
+	size := int64(len(key)) + int64(value.Len())
+	to := c.a1in
+	if ele, ok := c.cache[key]; ok {
+		kv := ele.Value.(*entry)
+		switch kv.queue {
+		case c.a1out:
+			to = c.am
+		case c.am:
+			to = c.am
+			c.nbytes -= kv.size
+		default:
+			//a1in中的记录原地更新，不改变FIFO顺序
+			c.nbytes += size - kv.size
+			c.a1in.bytes += size - kv.size
+			kv.value, kv.expire, kv.size = value, expire, size
+			c.evict()
+			return
+		}
+		c.drop(ele)
+	}
+	c.push(&entry{key: key, value: value, expire: expire, size: size}, to)
+	c.nbytes += size
+	c.evict()
+}
+
+func (c *Cache) evict() {
+	for c.maxBytes != 0 && c.maxBytes < c.nbytes {
+		c.RemoveOldest()
+	}
+}
+
+func (c *Cache) push(kv *entry, to *queue) {
+	kv.queue = to
+	to.bytes += kv.size
+	c.cache[kv.key] = to.ll.PushFront(kv)
+}
+
+func (c *Cache) drop(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	kv.queue.ll.Remove(ele)
+	kv.queue.bytes -= kv.size
+	delete(c.cache, kv.key)
+}
+
+//
+// Remove
+// @Description: 删除指定key的缓存，返回是否存在
+// @receiver c
+// @param key
+// @return bool
+//
+func (c *Cache) Remove(key string) bool {
+	ele, ok := c.cache[key]
+	if !ok {
+		return false
+	}
+	if ele.Value.(*entry).queue == c.a1out {
+		c.drop(ele)
+		return false
+	}
+	c.removeElement(ele)
+	return true
+}
+
+func (c *Cache) removeElement(ele *list.Element) {
+	kv := ele.Value.(*entry)
+	c.drop(ele)
+	c.nbytes -= kv.size
+	if c.OnEvicted != nil {
+		c.OnEvicted(kv.key, kv.value)
+	}
+}
+
+//
+// RemoveExpired
+// @Description: 清理所有已过期的缓存，返回清理的条数
+// @receiver c
+// @return int
+//
+func (c *Cache) RemoveExpired() int {
+	now := time.Now()
+	removed := 0
+	for _, q := range []*queue{c.a1in, c.am} {
+		for ele := q.ll.Back(); ele != nil; {
+			prev := ele.Prev()
+			if ele.Value.(*entry).expired(now) {
+				c.removeElement(ele)
+				removed++
+			}
+			ele = prev
+		}
+	}
+	return removed
+}
+
+//
+// Range
+// @Description: 依次从旧到新遍历a1in与am，不包括幽灵记录，跳过已过期的记录，不改变访问顺序，fn返回false时停止
+// @receiver c
+// @param fn
+//
+func (c *Cache) Range(fn func(key string, value Value, expire time.Time) bool) {
+	now := time.Now()
+	for _, q := range []*queue{c.a1in, c.am} {
+		for ele := q.ll.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*entry)
+			if !kv.expired(now) && !fn(kv.key, kv.value, kv.expire) {
+				return
+			}
+		}
+	}
+}
+
+//
+// Bytes
+// @Description: 当前已使用内存
+// @receiver c
+// @return int64
+//
+func (c *Cache) Bytes() int64 {
+	return c.nbytes
+}
+
+func (c *Cache) Len() int {
+	return c.a1in.ll.Len() + c.am.ll.Len()
+}
@@ -0,0 +1,96 @@
+package twoq
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+type String string
+
+func (d String) Len() int {
+	return len(d)
+}
+
+func TestScan(t *testing.T) {
+	q := New(80, nil)
+	//写入两次的记录经a1out进入am
+	for i := 0; i < 5; i++ {
+		q.Add("hot"+strconv.Itoa(i), String("v"))
+	}
+	//将hot挤出a1in，但仍保留在a1out中
+	for i := 0; i < 14; i++ {
+		q.Add("fill"+strconv.Itoa(i), String("v"))
+	}
+	for i := 0; i < 5; i++ {
+		q.Add("hot"+strconv.Itoa(i), String("v"))
+	}
+	for i := 0; i < 100; i++ {
+		q.Add("scan"+strconv.Itoa(i), String("v"))
+	}
+	for i := 0; i < 5; i++ {
+		if _, ok := q.Get("hot" + strconv.Itoa(i)); !ok {
+			t.Fatalf("hot key %d evicted by scan", i)
+		}
+	}
+	if q.Bytes() > 80 {
+		t.Fatalf("bytes %d exceeds limit", q.Bytes())
+	}
+}
+
+func TestGhost(t *testing.T) {
+	var evicted []string
+	//每条记录占用4字节，a1in超过4字节即淘汰
+	q := New(16, func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	for i := 1; i <= 5; i++ {
+		q.Add("k"+strconv.Itoa(i), String("v"+strconv.Itoa(i)))
+	}
+	if len(evicted) != 1 || evicted[0] != "k1" {
+		t.Fatalf("expected k1 evicted, got %v", evicted)
+	}
+	if _, ok := q.Get("k1"); ok {
+		t.Fatalf("ghost entry should not be returned")
+	}
+	q.Add("k1", String("v1"))
+	if q.am.ll.Len() != 1 || q.Len() != 4 || q.Bytes() != 16 {
+		t.Fatalf("unexpected state am=%d len=%d bytes=%d", q.am.ll.Len(), q.Len(), q.Bytes())
+	}
+}
+
+func TestRemove(t *testing.T) {
+	evicted := make([]string, 0)
+	q := New(0, func(key string, value Value) {
+		evicted = append(evicted, key)
+	})
+	q.Add("key1", String("1234"))
+	q.Add("key2", String("5678"))
+	q.Add("key2", String("56"))
+	if !q.Remove("key1") || q.Remove("key1") {
+		t.Fatalf("remove should report existence")
+	}
+	if q.Len() != 1 || q.Bytes() != int64(len("key2")+len("56")) {
+		t.Fatalf("unexpected len %d bytes %d", q.Len(), q.Bytes())
+	}
+	if len(evicted) != 1 || evicted[0] != "key1" {
+		t.Fatalf("OnEvicted not called, got %v", evicted)
+	}
+}
+
+func TestExpire(t *testing.T) {
+	q := New(0, nil)
+	q.AddWithExpire("key1", String("1234"), time.Now().Add(-time.Second))
+	q.AddWithExpire("key2", String("5678"), time.Now().Add(time.Hour))
+	q.Add("key3", String("9"))
+	if _, ok := q.Get("key1"); ok || q.Len() != 2 {
+		t.Fatalf("expired key1 should be removed lazily")
+	}
+	q.AddWithExpire("key2", String("5678"), time.Now().Add(-time.Second))
+	if n := q.RemoveExpired(); n != 1 || q.Len() != 1 {
+		t.Fatalf("expected 1 expired entry removed, got %d", n)
+	}
+	if _, ok := q.Get("key3"); !ok {
+		t.Fatalf("key3 should never expire")
+	}
+}
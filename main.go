@@ -1,11 +1,21 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"gocache"
+	"gocache/diskcache"
+	"gocache/membership"
 	"log"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
 )
 
 var db = map[string]string{
@@ -14,30 +24,187 @@ var db = map[string]string{
 	"Sam":  "567",
 }
 
-func createGroup() *gocache.Group {
+var (
+	//节点分布算法，所有节点须使用同一种
+	placements = map[string]gocache.PlacementFunc{
+		"ring":       gocache.ConsistentHash,
+		"rendezvous": gocache.Rendezvous,
+		"jump":       gocache.JumpHash,
+		"maglev":     gocache.Maglev,
+	}
+	//日志级别，debug会输出每次请求的日志
+	logLevels = map[string]gocache.Level{
+		"debug": gocache.LevelDebug,
+		"info":  gocache.LevelInfo,
+		"warn":  gocache.LevelWarn,
+		"error": gocache.LevelError,
+	}
+)
+
+func createGroup(opts ...gocache.GroupOption) *gocache.Group {
+	opts = append(opts, gocache.WithNegativeCache(5*time.Second, 1<<10))
 	return gocache.NewGroup("scores", 2<<10, gocache.GetterFunc(
 		func(key string) ([]byte, error) {
 			log.Println("[SlowDB] search key", key)
 			if v, ok := db[key]; ok {
 				return []byte(v), nil
 			}
-			return nil, fmt.Errorf("%s not exist", key)
-		}))
+			return nil, fmt.Errorf("%s not exist: %w", key, gocache.ErrNotFound)
+		}), opts...)
+}
+
+//
+// parsePeers
+// @Description: 解析节点列表，节点可写作addr=weight指定权重，默认权重为1
+// @param list
+// @return addrs
+// @return weights
+//
+func parsePeers(list string) (addrs []string, weights map[string]int) {
+	weights = make(map[string]int)
+	for _, peer := range strings.Split(list, ",") {
+		weight := 1
+		if i := strings.LastIndex(peer, "="); i >= 0 {
+			w, err := strconv.Atoi(peer[i+1:])
+			if err != nil {
+				log.Fatalf("invalid weight of peer %s: %v", peer, err)
+			}
+			peer, weight = peer[:i], w
+		}
+		addrs = append(addrs, peer)
+		weights[peer] = weight
+	}
+	return addrs, weights
+}
+
+//
+// restoreSnapshot
+// @Description: 启动时从path恢复缓存，文件不存在时跳过
+// @param path
+// @param goGroup
+//
+func restoreSnapshot(path string, goGroup *gocache.Group) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+	if err = goGroup.Restore(f); err != nil {
+		log.Println("restore snapshot failed:", err)
+		return
+	}
+	log.Println("cache restored from snapshot", path)
 }
 
-func startCacheServer(addr string, addrs []string, goGroup *gocache.Group) {
-	peers := gocache.NewHTTPPool(addr)
-	peers.Set(addrs...)
+//
+// saveSnapshot
+// @Description: 先写入临时文件再重命名，避免进程中途退出留下不完整的快照
+// @param path
+// @param goGroup
+// @return error
+//
+func saveSnapshot(path string, goGroup *gocache.Group) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if err = goGroup.Snapshot(f); err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+//
+// snapshotOnExit
+// @Description: 收到SIGTERM或中断信号时写入快照后退出
+// @param path
+// @param goGroup
+//
+func snapshotOnExit(path string, goGroup *gocache.Group) {
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		<-sig
+		if err := saveSnapshot(path, goGroup); err != nil {
+			log.Fatal("save snapshot failed: ", err)
+		}
+		log.Println("cache saved to snapshot", path)
+		os.Exit(0)
+	}()
+}
+
+func startCacheServer(addr string, weights map[string]int, gossipAddr string, seeds []string, goGroup *gocache.Group,
+	logger gocache.Logger, opts ...gocache.HTTPPoolOption) {
+	opts = append(opts, gocache.WithMetricsPath("/_gocache_metrics"))
+	peers := gocache.NewHTTPPool(addr, opts...)
+	if gossipAddr != "" {
+		//开启gossip时节点自动发现，忽略静态配置
+		startMembership(addr, gossipAddr, seeds, peers, logger)
+	} else {
+		peers.SetWeighted(weights)
+	}
 	goGroup.RegisterPeers(peers)
 	log.Println("gocache server is running at :", addr)
 	log.Fatal(http.ListenAndServe(addr[7:], peers))
 }
 
+func startMembership(addr string, gossipAddr string, seeds []string, peers *gocache.HTTPPool, logger gocache.Logger) {
+	m, err := membership.New(membership.Config{
+		Name:     addr,
+		BindAddr: gossipAddr,
+		Logger:   logger,
+		OnChange: func(joined, left []string) {
+			log.Println("membership changed, joined:", joined, "left:", left)
+			peers.AddPeers(joined...)
+			peers.RemovePeers(left...)
+		},
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(seeds) > 0 {
+		if err = m.Join(seeds...); err != nil {
+			log.Println("join cluster failed:", err)
+		}
+	}
+	log.Println("gossip is running at :", m.Addr())
+}
+
+func startGRPCCacheServer(addr string, addrs []string, goGroup *gocache.Group, logger gocache.Logger) {
+	peers := gocache.NewGRPCPool(addr)
+	peers.SetLogger(logger)
+	if err := peers.Set(addrs...); err != nil {
+		log.Fatal(err)
+	}
+	goGroup.RegisterPeers(peers)
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Println("gocache grpc server is running at :", addr)
+	log.Fatal(peers.Serve(lis))
+}
+
 func startAPIServer(apiAddr string, goGroup *gocache.Group) {
 	http.Handle("/api", http.HandlerFunc(
 		func(w http.ResponseWriter, r *http.Request) {
 			key := r.URL.Query().Get("key")
 			view, err := goGroup.Get(key)
+			if errors.Is(err, gocache.ErrNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusInternalServerError)
 				return
@@ -51,25 +218,75 @@ func startAPIServer(apiAddr string, goGroup *gocache.Group) {
 }
 
 func main() {
-	var port int
-	var api bool
+	var port, replication, handoffRate int
+	var l2Bytes int64
+	var api, useGRPC bool
+	var peerList, gossipAddr, seedList, placementName, snapshotPath, l2Dir, logLevel, adminToken string
 	flag.IntVar(&port, "port", 8001, "gocache server port")
 	flag.BoolVar(&api, "api", false, "start a api server?")
+	flag.BoolVar(&useGRPC, "grpc", false, "use grpc between peers?")
+	flag.StringVar(&peerList, "peers", "http://localhost:8001,http://localhost:8002,http://localhost:8003",
+		"comma separated initial peers, append =weight to give a peer more keys (e.g. http://localhost:8001=2), more can join at runtime via /_gocache_admin/peers when -admin-token is set")
+	flag.StringVar(&gossipAddr, "gossip", "", "udp address for gossip membership, e.g. localhost:7001")
+	flag.StringVar(&seedList, "seeds", "", "comma separated gossip addresses of existing nodes to join")
+	flag.StringVar(&placementName, "placement", "ring", "key placement algorithm: ring, rendezvous, jump or maglev")
+	flag.IntVar(&replication, "replication", 1, "number of nodes each key is stored on, including its owner")
+	flag.IntVar(&handoffRate, "handoff", 1000, "keys per second pushed to their new owners after a ring change, 0 to disable")
+	flag.StringVar(&snapshotPath, "snapshot", "", "file to restore the cache from on startup and save it to on SIGTERM")
+	flag.StringVar(&l2Dir, "l2", "", "directory for a disk cache holding keys evicted from memory")
+	flag.Int64Var(&l2Bytes, "l2-bytes", 1<<30, "disk budget of the l2 cache in bytes")
+	flag.StringVar(&logLevel, "log-level", "info", "log level: debug, info, warn or error")
+	flag.StringVar(&adminToken, "admin-token", os.Getenv("GOCACHE_ADMIN_TOKEN"),
+		"enable /_gocache_admin/ and require this bearer token, defaults to $GOCACHE_ADMIN_TOKEN")
 	flag.Parse()
-	apiAddr := "http://localhost:9999"
-	addrMap := map[int]string{
-		8001: "http://localhost:8001",
-		8002: "http://localhost:8002",
-		8003: "http://localhost:8003",
+	placement, ok := placements[placementName]
+	if !ok {
+		log.Fatalf("unknown placement %s", placementName)
 	}
-	var addrs []string
-	for _, v := range addrMap {
-		addrs = append(addrs, v)
+	level, ok := logLevels[logLevel]
+	if !ok {
+		log.Fatalf("unknown log level %s", logLevel)
 	}
+	logger := gocache.NewStdLogger(nil, level)
+	apiAddr := "http://localhost:9999"
+	addr := fmt.Sprintf("http://localhost:%d", port)
+	addrs, weights := parsePeers(peerList)
 
-	goGroup := createGroup()
+	groupOpts := []gocache.GroupOption{gocache.WithLogger(logger)}
+	if l2Dir != "" {
+		store, err := diskcache.Open(l2Dir, l2Bytes, 0)
+		if err != nil {
+			log.Fatal(err)
+		}
+		groupOpts = append(groupOpts, gocache.WithL2Cache(store))
+	}
+	goGroup := createGroup(groupOpts...)
+	if snapshotPath != "" {
+		restoreSnapshot(snapshotPath, goGroup)
+		snapshotOnExit(snapshotPath, goGroup)
+	}
 	if api {
 		go startAPIServer(apiAddr, goGroup)
 	}
-	startCacheServer(addrMap[port], []string(addrs), goGroup)
+	if useGRPC {
+		//grpc节点地址不带协议前缀
+		for i := range addrs {
+			addrs[i] = strings.TrimPrefix(addrs[i], "http://")
+		}
+		startGRPCCacheServer(strings.TrimPrefix(addr, "http://"), addrs, goGroup, logger)
+		return
+	}
+	var seeds []string
+	if seedList != "" {
+		seeds = strings.Split(seedList, ",")
+	}
+	poolOpts := []gocache.HTTPPoolOption{
+		gocache.WithPlacement(placement), gocache.WithReplication(replication), gocache.WithHandoff(handoffRate),
+		gocache.WithPoolLogger(logger),
+	}
+	if adminToken != "" {
+		//管理接口可变更节点，只在设置令牌时开启
+		poolOpts = append(poolOpts, gocache.WithAdminPath("/_gocache_admin/"), gocache.WithAdminToken(adminToken))
+	}
+	startCacheServer(addr, weights, gossipAddr, seeds, goGroup, logger, poolOpts...)
 }